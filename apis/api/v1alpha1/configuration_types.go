@@ -17,49 +17,465 @@ limitations under the License.
 package v1alpha1
 
 import (
+	kcore "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// ConfigurationSpec defines the desired state of the Misconfiguration to be applied to deployments
+// ConfigurationSpec defines the desired state of the Misconfiguration to be applied to workloads.
+// Fields that are not set leave the workload unchanged.
 type ConfigurationSpec struct {
 
+	// Revert the misconfiguration by restoring the original pod template of every workload
+	// the Configuration was injected into. No misconfiguration is injected while set.
+	Revert bool `json:"revert,omitempty"`
+
+	// Suspend the Configuration. No workload is misconfigured while suspended, the schedule resumes
+	// once unsuspended. Runs missed while suspended are handled like other missed runs.
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Revert the workloads the Configuration is injected into when it is suspended
+	RevertOnSuspend bool `json:"revertOnSuspend,omitempty"`
+
+	// Compute the misconfiguration of every eligible workload and report the diff in the status
+	// without changing any workload
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Duration the misconfiguration stays injected, e.g. 30m. Once expired, the original pod template
+	// of the workload is restored. Defaults to keeping the misconfiguration until it is reverted.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// Schedule of the injections in cron format, e.g. "0 9 * * 1-5". On every scheduled run all
+	// annotated workloads are misconfigured. Without a schedule, workloads are misconfigured as soon
+	// as their annotation is set to "true".
+	Schedule string `json:"schedule,omitempty"`
+
+	// Time zone the schedule is interpreted in, e.g. Europe/Berlin. Defaults to the time zone of the controller.
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// Deadline in seconds for starting a scheduled run that was missed, e.g. while the controller was down.
+	// Missed runs are started at most once and skipped when the deadline has passed.
+	// +kubebuilder:validation:Minimum=0
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// Select the namespaces of the targeted workloads by label. Defaults to all namespaces.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Select the targeted workloads by label. Defaults to all annotated workloads.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// CEL expression evaluated against every selected workload, which is bound to "object", e.g.
+	// object.spec.replicas > 1. Only workloads for which it returns true are targeted.
+	TargetExpression string `json:"targetExpression,omitempty"`
+
+	// Patch resources of any namespaced kind, e.g. Ingresses or custom resources, instead of the pod
+	// template of workloads. The pod template misconfiguration is ignored while set.
+	Patch *PatchConfiguration `json:"patch,omitempty"`
+
+	// Conditions a workload must meet before it is misconfigured. Defaults to workloads that are
+	// available and fully rolled out.
+	ReadinessGate *ReadinessGate `json:"readinessGate,omitempty"`
+
+	// Revert workloads whose rollout fails after the misconfiguration was injected. Enabled by default.
+	RolloutGuard *RolloutGuard `json:"rolloutGuard,omitempty"`
+
+	// Pick a random subset of the eligible workloads on every run
+	Sampling *Sampling `json:"sampling,omitempty"`
+
+	// Maximum number of workloads misconfigured per run
+	// +kubebuilder:validation:Minimum=0
+	MaxTargets *int32 `json:"maxTargets,omitempty"`
+
+	// Maximum percentage of the selected workloads misconfigured per run, rounded down
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	MaxPercent *int32 `json:"maxPercent,omitempty"`
+
+	// Select the containers the misconfiguration is applied to
+	Containers *ContainerSelector `json:"containers,omitempty"`
+
 	// Set Container Imagetag
-	ImageTag string `json:"imageTag,omitempty"`
+	ImageTag *string `json:"imageTag,omitempty"`
 
 	// Set ContainerPort
-	ContainerPort int32 `json:"containerPort,omitempty"`
+	ContainerPort *int32 `json:"containerPort,omitempty"`
 
 	// Set allowPrivilegeEscalation
-	AllowPrivilegeEscalation bool `json:"allowPrivilegeEscalation,omitempty"`
+	AllowPrivilegeEscalation *bool `json:"allowPrivilegeEscalation,omitempty"`
 
 	// Set readOnlyRootFilesystem
-	ReadOnlyRootFilesystem bool `json:"readOnlyRootFilesystem,omitempty"`
+	ReadOnlyRootFilesystem *bool `json:"readOnlyRootFilesystem,omitempty"`
 
 	// Set runAsNonRoot
-	RunAsNonRoot bool `json:"runAsNonRoot,omitempty"`
+	RunAsNonRoot *bool `json:"runAsNonRoot,omitempty"`
+
+	// Set privileged
+	Privileged *bool `json:"privileged,omitempty"`
+
+	// Add capabilities to or remove them from the drop list of the container
+	Capabilities *CapabilitiesConfiguration `json:"capabilities,omitempty"`
+
+	// Set runAsUser, e.g. 0 to run as root
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+
+	// Set the seccomp profile type
+	// +kubebuilder:validation:Enum=Unconfined;RuntimeDefault
+	SeccompProfile *kcore.SeccompProfileType `json:"seccompProfile,omitempty"`
+
+	// Set the AppArmor profile of the container, e.g. unconfined
+	// +kubebuilder:validation:Pattern=`^(unconfined|runtime/default|localhost/.+)$`
+	AppArmorProfile *string `json:"appArmorProfile,omitempty"`
+
+	// Set procMount
+	// +kubebuilder:validation:Enum=Default;Unmasked
+	ProcMount *kcore.ProcMountType `json:"procMount,omitempty"`
+
+	// Pod level misconfiguration of host namespaces and host access
+	PodSecurity *PodSecurityConfiguration `json:"podSecurity,omitempty"`
+
+	// hostPath volumes mounted into the selected containers
+	Volumes []HostPathVolume `json:"volumes,omitempty"`
 
 	// CPU limits
-	CPULimits resource.Quantity `json:"limits,omitempty"`
+	CPULimits *resource.Quantity `json:"limits,omitempty"`
 
 	// Memory limits
-	MemoryLimits resource.Quantity `json:"memorylimits,omitempty"`
+	MemoryLimits *resource.Quantity `json:"memorylimits,omitempty"`
 
 	//CPU requests
-	CPURequests resource.Quantity `json:"requests,omitempty"`
+	CPURequests *resource.Quantity `json:"requests,omitempty"`
 
 	// Memory requests
-	MemoryRequests resource.Quantity `json:"memoryrequests,omitempty"`
+	MemoryRequests *resource.Quantity `json:"memoryrequests,omitempty"`
+}
+
+// ContainerSelector selects the containers of a pod template that are misconfigured
+type ContainerSelector struct {
+
+	// Names of the containers to target. Entries may be glob patterns such as "app-*",
+	// "all" or "*" targets every container. If empty, only the first container is targeted.
+	Names []string `json:"names,omitempty"`
+
+	// Also target init containers matching Names
+	IncludeInitContainers bool `json:"includeInitContainers,omitempty"`
+}
+
+// CapabilitiesConfiguration defines the capabilities to add to or remove from the drop list of a container
+type CapabilitiesConfiguration struct {
+
+	// Capabilities to add, e.g. SYS_ADMIN, NET_RAW or NET_ADMIN
+	Add []kcore.Capability `json:"add,omitempty"`
+
+	// Capabilities to remove from the drop list, e.g. ALL
+	RemoveDrop []kcore.Capability `json:"removeDrop,omitempty"`
+}
+
+// PodSecurityConfiguration defines the misconfiguration applied to the pod spec
+type PodSecurityConfiguration struct {
+
+	// Set hostNetwork
+	HostNetwork *bool `json:"hostNetwork,omitempty"`
+
+	// Set hostPID
+	HostPID *bool `json:"hostPID,omitempty"`
+
+	// Set hostIPC
+	HostIPC *bool `json:"hostIPC,omitempty"`
+
+	// Set shareProcessNamespace
+	ShareProcessNamespace *bool `json:"shareProcessNamespace,omitempty"`
+
+	// Set automountServiceAccountToken
+	AutomountServiceAccountToken *bool `json:"automountServiceAccountToken,omitempty"`
+
+	// Bind ports of the selected containers to ports on the host
+	HostPorts []HostPortBinding `json:"hostPorts,omitempty"`
+}
+
+// HostPortBinding binds a container port to a port on the host
+type HostPortBinding struct {
+
+	// Container port to bind
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	ContainerPort int32 `json:"containerPort"`
+
+	// Port on the host, defaults to ContainerPort
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	HostPort *int32 `json:"hostPort,omitempty"`
+}
+
+// HostPathVolume defines a hostPath volume that is mounted into the selected containers
+type HostPathVolume struct {
+
+	// Name of the volume, injected with the "misconfiguration-" prefix
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=46
+	Name string `json:"name"`
+
+	// Path on the host, e.g. /, /var/run/docker.sock, /var/run/containerd/containerd.sock, /etc or /proc
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
+
+	// Type of the hostPath volume
+	Type *kcore.HostPathType `json:"type,omitempty"`
+
+	// Path the volume is mounted at in the containers, defaults to Path
+	MountPath string `json:"mountPath,omitempty"`
+
+	// Mount the volume read-write instead of read-only
+	ReadWrite bool `json:"readWrite,omitempty"`
+}
+
+// ContainerResult records the fields that were changed on a single container
+type ContainerResult struct {
+
+	// Name of the container
+	Name string `json:"name"`
+
+	// Whether the container is an init container
+	InitContainer bool `json:"initContainer,omitempty"`
+
+	// Fields that were changed on the container
+	Fields []string `json:"fields,omitempty"`
+}
+
+// PatchType is the type of a patch
+// +kubebuilder:validation:Enum=JSONPatch;MergePatch;StrategicMergePatch
+type PatchType string
+
+const (
+	// PatchTypeJSONPatch is a JSON patch (RFC 6902)
+	PatchTypeJSONPatch PatchType = "JSONPatch"
+	// PatchTypeMergePatch is a JSON merge patch (RFC 7386)
+	PatchTypeMergePatch PatchType = "MergePatch"
+	// PatchTypeStrategicMergePatch is a strategic merge patch, only supported by built-in kinds
+	PatchTypeStrategicMergePatch PatchType = "StrategicMergePatch"
+)
+
+// PatchConfiguration defines the patch applied to the selected resources of a kind
+type PatchConfiguration struct {
+
+	// API version of the patched resources, e.g. networking.k8s.io/v1 or argoproj.io/v1alpha1
+	// +kubebuilder:validation:MinLength=1
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the patched resources, e.g. Ingress or Rollout
+	// +kubebuilder:validation:MinLength=1
+	Kind string `json:"kind"`
+
+	// Type of the patch. Defaults to MergePatch.
+	// +kubebuilder:default=MergePatch
+	Type PatchType `json:"type,omitempty"`
+
+	// Patch document in JSON or YAML. Metadata and status of the resources are not patched.
+	// +kubebuilder:validation:MinLength=1
+	Patch string `json:"patch"`
+}
+
+// ReadinessGate defines when a workload is ready to be misconfigured
+type ReadinessGate struct {
+	// Require the Available condition of the workload to be true. Defaults to true.
+	RequireAvailable *bool `json:"requireAvailable,omitempty"`
+
+	// Require the rollout of the latest revision to be complete, with every replica updated and
+	// available and no replicas of older revisions left. Defaults to true.
+	RequireRolloutComplete *bool `json:"requireRolloutComplete,omitempty"`
+}
+
+// RolloutGuard defines when the rollout of a misconfigured workload counts as failed
+type RolloutGuard struct {
+	// Disable reverting workloads whose rollout failed
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Number of restarts of a container of the misconfigured pods after which the rollout
+	// counts as failed. Defaults to 3.
+	// +kubebuilder:validation:Minimum=1
+	MaxRestarts *int32 `json:"maxRestarts,omitempty"`
+}
+
+// Condition types of a Configuration
+const (
+	// ConditionReady is true when the Configuration was reconciled without errors
+	ConditionReady = "Ready"
+	// ConditionInjected is true when the misconfiguration is injected into at least one workload
+	ConditionInjected = "Injected"
+	// ConditionReverted is true when the injected misconfiguration was reverted
+	ConditionReverted = "Reverted"
+	// ConditionDegraded is true when the misconfiguration could not be applied to every targeted workload
+	ConditionDegraded = "Degraded"
+	// ConditionConflicted is true when another Configuration claims a workload selected by the Configuration
+	ConditionConflicted = "Conflicted"
+	// ConditionFailed is true when the rollout of a misconfigured workload failed and was reverted
+	ConditionFailed = "Failed"
+	// ConditionSuspended is true while the Configuration is suspended
+	ConditionSuspended = "Suspended"
+	// ConditionHalted is true while the cluster-wide kill switch is engaged
+	ConditionHalted = "Halted"
+)
+
+// AffectedWorkload records the misconfiguration injected into a workload
+type AffectedWorkload struct {
+
+	// Kind of the workload
+	Kind string `json:"kind"`
+
+	// Namespace of the workload
+	Namespace string `json:"namespace"`
+
+	// Name of the workload
+	Name string `json:"name"`
+
+	// Pod level fields that were changed
+	Fields []string `json:"fields,omitempty"`
+
+	// Containers that were changed
+	Containers []ContainerResult `json:"containers,omitempty"`
+
+	// Time the misconfiguration was injected
+	InjectionTime metav1.Time `json:"injectionTime"`
+}
+
+// FailedWorkload records a workload whose rollout failed after the injection
+type FailedWorkload struct {
+	WorkloadReference `json:",inline"`
+
+	// Reason the rollout failed, e.g. ProgressDeadlineExceeded, CrashLoop or ImagePullBackOff
+	Reason string `json:"reason"`
+
+	// Details of the failure
+	Message string `json:"message,omitempty"`
+
+	// Time the failure was detected and the workload reverted
+	FailureTime metav1.Time `json:"failureTime"`
+}
+
+// SamplingMode defines how eligible workloads are sampled
+// +kubebuilder:validation:Enum=Probability;Count
+type SamplingMode string
+
+const (
+	// SamplingProbability picks every eligible workload with the configured probability
+	SamplingProbability SamplingMode = "Probability"
+	// SamplingCount picks a fixed number of eligible workloads
+	SamplingCount SamplingMode = "Count"
+)
+
+// Sampling defines how a random subset of the eligible workloads is picked
+type Sampling struct {
+
+	// Sampling mode, either Probability or Count
+	Mode SamplingMode `json:"mode"`
+
+	// Probability between 0 and 1 each eligible workload is picked with in the Probability mode
+	// +kubebuilder:validation:Pattern=`^(0(\.[0-9]+)?|1(\.0+)?)$`
+	Probability string `json:"probability,omitempty"`
+
+	// Number of eligible workloads picked in the Count mode
+	// +kubebuilder:validation:Minimum=0
+	Count *int32 `json:"count,omitempty"`
+
+	// Seed of the random sampling, set it to the seed recorded in the status to replay a run.
+	// A new seed is generated for every run if not set.
+	Seed *int64 `json:"seed,omitempty"`
+}
+
+// WorkloadReference references a workload
+type WorkloadReference struct {
+
+	// Kind of the workload
+	Kind string `json:"kind"`
+
+	// Namespace of the workload
+	Namespace string `json:"namespace"`
+
+	// Name of the workload
+	Name string `json:"name"`
+}
+
+// SkippedWorkload records a targeted workload the misconfiguration was not injected into
+type SkippedWorkload struct {
+	WorkloadReference `json:",inline"`
+
+	// Reason the workload was skipped
+	Reason string `json:"reason"`
+
+	// Details on why the workload was skipped
+	Message string `json:"message,omitempty"`
+}
+
+// DryRunResult records the misconfiguration that would be injected into a workload
+type DryRunResult struct {
+	WorkloadReference `json:",inline"`
+
+	// Pod level fields that would be changed
+	Fields []string `json:"fields,omitempty"`
+
+	// Containers that would be changed
+	Containers []ContainerResult `json:"containers,omitempty"`
+
+	// JSON patch of the changes to the workload. Omitted when the diffs are stored in the DryRunConfigMap.
+	Diff string `json:"diff,omitempty"`
 }
 
 // ConfigurationStatus defines the observed state of Configuration
 type ConfigurationStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+
+	// Generation of the Configuration last processed by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions of the Configuration: Ready, Injected, Reverted, Degraded, Conflicted, Failed, Suspended and Halted
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Time the misconfiguration was last injected into a workload
+	LastInjectionTime *metav1.Time `json:"lastInjectionTime,omitempty"`
+
+	// Time the misconfiguration was last reverted on a workload
+	LastRevertTime *metav1.Time `json:"lastRevertTime,omitempty"`
+
+	// Scheduled time of the last run
+	LastRunTime *metav1.Time `json:"lastRunTime,omitempty"`
+
+	// Time of the next scheduled run
+	NextScheduledTime *metav1.Time `json:"nextScheduledTime,omitempty"`
+
+	// Workloads the misconfiguration is injected into
+	AffectedWorkloads []AffectedWorkload `json:"affectedWorkloads,omitempty"`
+
+	// Misconfiguration that would be injected in the last dry run
+	DryRunResults []DryRunResult `json:"dryRunResults,omitempty"`
+
+	// ConfigMap holding the diffs of the last dry run when they are too large for the status
+	DryRunConfigMap string `json:"dryRunConfigMap,omitempty"`
+
+	// Seed of the random sampling used in the last run
+	SamplingSeed *int64 `json:"samplingSeed,omitempty"`
+
+	// Workloads selected for the misconfiguration in the last run
+	SelectedWorkloads []WorkloadReference `json:"selectedWorkloads,omitempty"`
+
+	// Targeted workloads skipped in the last run
+	SkippedWorkloads []SkippedWorkload `json:"skippedWorkloads,omitempty"`
+
+	// Workloads that were reverted because their rollout failed. They are not misconfigured again
+	// until their annotation is set back to "true".
+	FailedWorkloads []FailedWorkload `json:"failedWorkloads,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Injected",type=string,JSONPath=`.status.conditions[?(@.type=="Injected")].status`
+//+kubebuilder:printcolumn:name="Degraded",type=string,JSONPath=`.status.conditions[?(@.type=="Degraded")].status`
+//+kubebuilder:printcolumn:name="Failed",type=string,JSONPath=`.status.conditions[?(@.type=="Failed")].status`
+//+kubebuilder:printcolumn:name="Last Injection",type=date,JSONPath=`.status.lastInjectionTime`
+//+kubebuilder:printcolumn:name="Last Revert",type=date,JSONPath=`.status.lastRevertTime`,priority=1
+//+kubebuilder:printcolumn:name="Next Run",type=date,JSONPath=`.status.nextScheduledTime`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Configuration is the Schema for the configurations API
 type Configuration struct {
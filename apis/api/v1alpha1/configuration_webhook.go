@@ -0,0 +1,99 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/AnaisUrlichs/security-controller/pkg/expression"
+	"github.com/AnaisUrlichs/security-controller/pkg/patch"
+)
+
+// log is for logging in this package.
+var configurationlog = logf.Log.WithName("configuration-resource")
+
+func (r *Configuration) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-api-core-anaisurl-com-v1alpha1-configuration,mutating=false,failurePolicy=fail,sideEffects=None,groups=api.core.anaisurl.com,resources=configurations,verbs=create;update,versions=v1alpha1,name=vconfiguration.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Configuration{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Configuration) ValidateCreate() error {
+	configurationlog.Info("validate create", "name", r.Name)
+	return r.validateConfiguration()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+// Configurations whose target expression and patch did not change are accepted, so those created
+// before the webhook was enabled can still be reverted and deleted.
+func (r *Configuration) ValidateUpdate(old runtime.Object) error {
+	configurationlog.Info("validate update", "name", r.Name)
+	if oldConf, ok := old.(*Configuration); ok && oldConf.Spec.TargetExpression == r.Spec.TargetExpression &&
+		equality.Semantic.DeepEqual(oldConf.Spec.Patch, r.Spec.Patch) {
+		return nil
+	}
+	return r.validateConfiguration()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Configuration) ValidateDelete() error {
+	return nil
+}
+
+// validateConfiguration compiles the target expression and parses the patch of the Configuration
+func (r *Configuration) validateConfiguration() error {
+	var allErrs field.ErrorList
+	if r.Spec.TargetExpression != "" {
+		if _, err := expression.Compile(r.Spec.TargetExpression); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "targetExpression"), r.Spec.TargetExpression, err.Error()))
+		}
+	}
+	if p := r.Spec.Patch; p != nil {
+		patchPath := field.NewPath("spec", "patch")
+		if _, err := schema.ParseGroupVersion(p.APIVersion); err != nil {
+			allErrs = append(allErrs, field.Invalid(patchPath.Child("apiVersion"), p.APIVersion, err.Error()))
+		}
+		if _, ok := patch.Types[string(p.Type)]; !ok && p.Type != "" {
+			var supported []string
+			for patchType := range patch.Types {
+				supported = append(supported, patchType)
+			}
+			sort.Strings(supported)
+			allErrs = append(allErrs, field.NotSupported(patchPath.Child("type"), p.Type, supported))
+		} else if _, _, err := patch.Parse(string(p.Type), p.Patch); err != nil {
+			allErrs = append(allErrs, field.Invalid(patchPath.Child("patch"), p.Patch, err.Error()))
+		}
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Configuration").GroupKind(), r.Name, allErrs)
+}
@@ -0,0 +1,456 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	kcore "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// fieldManager owns the fields changed by the misconfiguration
+	fieldManager = "security-controller"
+	// revertFieldManager owns the original values restored when the misconfiguration is reverted
+	revertFieldManager = "security-controller-revert"
+)
+
+// listMapKeys are the key fields of the associative lists of a pod template. The elements of
+// these lists are merged by server-side apply, all other lists are replaced as a whole.
+var listMapKeys = map[string][]string{
+	"containers":          {"name"},
+	"initContainers":      {"name"},
+	"ephemeralContainers": {"name"},
+	"volumes":             {"name"},
+	"volumeMounts":        {"mountPath"},
+	"ports":               {"containerPort", "protocol"},
+	"env":                 {"name"},
+}
+
+// applyIntent returns the object applied for the workload with the given fields
+func applyIntent(gvk schema.GroupVersionKind, obj client.Object, annotations map[string]string, spec map[string]interface{}) *unstructured.Unstructured {
+	intent := &unstructured.Unstructured{}
+	intent.SetGroupVersionKind(gvk)
+	intent.SetNamespace(obj.GetNamespace())
+	intent.SetName(obj.GetName())
+	if len(annotations) > 0 {
+		intent.SetAnnotations(annotations)
+	}
+	if len(spec) > 0 {
+		intent.Object["spec"] = spec
+	}
+	return intent
+}
+
+// apply server-side applies the intent with the field manager, taking over conflicting fields
+func (r *ConfigurationReconciler) apply(ctx context.Context, intent *unstructured.Unstructured, manager string) error {
+	return r.Patch(ctx, intent, client.Apply, client.FieldOwner(manager), client.ForceOwnership)
+}
+
+// podTemplateChanges returns the fields of the misconfigured pod template that differ from the original
+func podTemplateChanges(original, misconfigured *kcore.PodTemplateSpec) (map[string]interface{}, error) {
+	originalObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(original)
+	if err != nil {
+		return nil, err
+	}
+	misconfiguredObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(misconfigured)
+	if err != nil {
+		return nil, err
+	}
+	return changedFields(originalObj, misconfiguredObj), nil
+}
+
+// changedFields returns the fields of modified that differ from original. Elements of associative
+// lists are matched by their keys and only carry their keys and changed fields. Other lists are
+// included as a whole, lists missing from modified are included as empty lists.
+func changedFields(original, modified map[string]interface{}) map[string]interface{} {
+	changed := map[string]interface{}{}
+
+	for key, value := range modified {
+		originalValue, ok := original[key]
+		if !ok {
+			changed[key] = value
+			continue
+		}
+		if reflect.DeepEqual(originalValue, value) {
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if o, ok := originalValue.(map[string]interface{}); ok {
+				if fields := changedFields(o, v); len(fields) > 0 {
+					changed[key] = fields
+				}
+				continue
+			}
+		case []interface{}:
+			if keys, ok := listMapKeys[key]; ok {
+				if o, ok := originalValue.([]interface{}); ok {
+					if elements := changedElements(o, v, keys); len(elements) > 0 {
+						changed[key] = elements
+					}
+					continue
+				}
+			}
+		}
+		changed[key] = value
+	}
+
+	for key, originalValue := range original {
+		if _, ok := modified[key]; ok {
+			continue
+		}
+		if _, isList := originalValue.([]interface{}); isList && listMapKeys[key] == nil {
+			changed[key] = []interface{}{}
+		}
+	}
+	return changed
+}
+
+// changedElements returns the elements of an associative list that were added or changed
+func changedElements(original, modified []interface{}, keys []string) []interface{} {
+	var changed []interface{}
+
+	for _, value := range modified {
+		element, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		originalElement := findElement(original, elementKey(element, keys))
+		if originalElement == nil {
+			changed = append(changed, element)
+			continue
+		}
+		fields := changedFields(originalElement, element)
+		if len(fields) == 0 {
+			continue
+		}
+		for k, v := range elementKey(element, keys) {
+			fields[k] = v
+		}
+		changed = append(changed, fields)
+	}
+	return changed
+}
+
+// containerPorts are the ports of a container that replace its current ports
+type containerPorts struct {
+	list  string
+	name  string
+	ports []kcore.ContainerPort
+}
+
+// replacedPorts returns the ports of the containers whose port keys differ between the pod specs.
+// Server-side apply merges the ports by their containerPort and protocol, so a changed port would be
+// added next to the original one instead of replacing it. These ports are replaced with a patch instead.
+func replacedPorts(original, modified *kcore.PodSpec) []containerPorts {
+	var replaced []containerPorts
+	for list, containers := range map[string][]kcore.Container{
+		"containers":     modified.Containers,
+		"initContainers": modified.InitContainers,
+	} {
+		originalContainers := original.Containers
+		if list == "initContainers" {
+			originalContainers = original.InitContainers
+		}
+		for _, c := range containers {
+			for _, o := range originalContainers {
+				if o.Name == c.Name && !equalPortKeys(o.Ports, c.Ports) {
+					replaced = append(replaced, containerPorts{list: list, name: c.Name, ports: c.Ports})
+				}
+			}
+		}
+	}
+	return replaced
+}
+
+// equalPortKeys reports whether both lists hold the same ports by their containerPort and protocol
+func equalPortKeys(a, b []kcore.ContainerPort) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ContainerPort != b[i].ContainerPort || portProtocol(a[i]) != portProtocol(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func portProtocol(port kcore.ContainerPort) kcore.Protocol {
+	if port.Protocol == "" {
+		return kcore.ProtocolTCP
+	}
+	return port.Protocol
+}
+
+// withoutPorts removes the replaced ports from the changed fields of a pod template, so they
+// are not applied. Containers left with only their name are removed as well.
+func withoutPorts(template map[string]interface{}, replaced []containerPorts) {
+	spec, ok := template["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, r := range replaced {
+		containers, ok := spec[r.list].([]interface{})
+		if !ok {
+			continue
+		}
+		kept := containers[:0]
+		for _, value := range containers {
+			if c, ok := value.(map[string]interface{}); ok && c["name"] == r.name {
+				delete(c, "ports")
+				if len(c) == 1 {
+					continue
+				}
+			}
+			kept = append(kept, value)
+		}
+		if len(kept) == 0 {
+			delete(spec, r.list)
+		} else {
+			spec[r.list] = kept
+		}
+	}
+	if len(spec) == 0 {
+		delete(template, "spec")
+	}
+}
+
+// replacePorts replaces the ports of the containers with a JSON patch. Each replacement tests
+// the name of the container first, so the patch fails if the containers were reordered meanwhile.
+func (r *ConfigurationReconciler) replacePorts(ctx context.Context, obj client.Object, replaced []containerPorts, manager string) error {
+	if len(replaced) == 0 {
+		return nil
+	}
+	kind := kindOf(obj)
+	podSpec := &kind.podTemplate(obj).Spec
+	templatePath := "/spec/" + strings.Join(kind.templatePath, "/") + "/spec"
+
+	var operations []map[string]interface{}
+	for _, ports := range replaced {
+		containers := podSpec.Containers
+		if ports.list == "initContainers" {
+			containers = podSpec.InitContainers
+		}
+		for i, c := range containers {
+			if c.Name != ports.name {
+				continue
+			}
+			path := fmt.Sprintf("%s/%s/%d", templatePath, ports.list, i)
+			operations = append(operations, map[string]interface{}{"op": "test", "path": path + "/name", "value": c.Name})
+			if len(ports.ports) > 0 {
+				operations = append(operations, map[string]interface{}{"op": "add", "path": path + "/ports", "value": ports.ports})
+			} else if len(c.Ports) > 0 {
+				operations = append(operations, map[string]interface{}{"op": "remove", "path": path + "/ports"})
+			}
+		}
+	}
+	data, err := json.Marshal(operations)
+	if err != nil {
+		return err
+	}
+	return r.Patch(ctx, obj, client.RawPatch(types.JSONPatchType, data), client.FieldOwner(manager))
+}
+
+// releaseOwnership removes the managed fields entries of the controller from the object once it was
+// reverted, so the restored values are left to the other field managers and no server-side apply of
+// another manager conflicts with the controller
+func (r *ConfigurationReconciler) releaseOwnership(ctx context.Context, obj client.Object) error {
+	managedFields, released := releasedManagedFields(obj.GetManagedFields(), fieldManager, revertFieldManager)
+	if !released {
+		return nil
+	}
+	// An empty entry clears the managed fields, an empty list would leave them unchanged
+	if len(managedFields) == 0 {
+		managedFields = []metav1.ManagedFieldsEntry{{}}
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": obj.GetResourceVersion(),
+			"managedFields":   managedFields,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return r.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data))
+}
+
+// releasedManagedFields returns the managed fields entries without the ones of the managers and
+// reports whether any entry was removed
+func releasedManagedFields(entries []metav1.ManagedFieldsEntry, managers ...string) ([]metav1.ManagedFieldsEntry, bool) {
+	kept := []metav1.ManagedFieldsEntry{}
+	for _, entry := range entries {
+		owned := false
+		for _, manager := range managers {
+			owned = owned || entry.Manager == manager
+		}
+		if !owned {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, len(kept) != len(entries)
+}
+
+// appliedFields returns the fields the field manager owns through server-side apply
+func appliedFields(obj client.Object, manager string) (map[string]interface{}, error) {
+	for _, managedFields := range obj.GetManagedFields() {
+		if managedFields.Manager != manager || managedFields.Operation != metav1.ManagedFieldsOperationApply || managedFields.FieldsV1 == nil {
+			continue
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(managedFields.FieldsV1.Raw, &fields); err != nil {
+			return nil, err
+		}
+		return fields, nil
+	}
+	return nil, nil
+}
+
+// ownedValues returns the values of obj at the fields of a managed fields set. Fields that do not
+// exist in obj are left out, so applying the result releases them.
+func ownedValues(fields map[string]interface{}, obj map[string]interface{}) map[string]interface{} {
+	values := map[string]interface{}{}
+
+	for field, subFields := range fields {
+		if !strings.HasPrefix(field, "f:") {
+			continue
+		}
+		name := strings.TrimPrefix(field, "f:")
+		value, ok := obj[name]
+		if !ok {
+			continue
+		}
+		sub, _ := subFields.(map[string]interface{})
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if !hasChildFields(sub) {
+				values[name] = v
+			} else if owned := ownedValues(sub, v); len(owned) > 0 {
+				values[name] = owned
+			}
+		case []interface{}:
+			if !hasElementFields(sub) {
+				values[name] = v
+			} else if owned := ownedElements(sub, v); len(owned) > 0 {
+				values[name] = owned
+			}
+		default:
+			values[name] = v
+		}
+	}
+	return values
+}
+
+// ownedElements returns the owned values of the elements of an associative list
+func ownedElements(fields map[string]interface{}, list []interface{}) []interface{} {
+	var elements []interface{}
+
+	for field, subFields := range fields {
+		if !strings.HasPrefix(field, "k:") {
+			continue
+		}
+		key := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(field, "k:")), &key); err != nil {
+			continue
+		}
+		element := findElement(list, key)
+		if element == nil {
+			continue
+		}
+		sub, _ := subFields.(map[string]interface{})
+		owned := ownedValues(sub, element)
+		if len(owned) == 0 {
+			continue
+		}
+		for k := range key {
+			owned[k] = element[k]
+		}
+		elements = append(elements, owned)
+	}
+	return elements
+}
+
+func hasChildFields(fields map[string]interface{}) bool {
+	for field := range fields {
+		if strings.HasPrefix(field, "f:") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasElementFields(fields map[string]interface{}) bool {
+	for field := range fields {
+		if strings.HasPrefix(field, "k:") {
+			return true
+		}
+	}
+	return false
+}
+
+// elementKey returns the key fields of a list element
+func elementKey(element map[string]interface{}, keys []string) map[string]interface{} {
+	key := map[string]interface{}{}
+	for _, k := range keys {
+		if v, ok := element[k]; ok {
+			key[k] = v
+		}
+	}
+	return key
+}
+
+// findElement returns the element of the list with the given key fields
+func findElement(list []interface{}, key map[string]interface{}) map[string]interface{} {
+	for _, value := range list {
+		element, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		matches := true
+		for k, v := range key {
+			if !jsonEqual(element[k], v) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return element
+		}
+	}
+	return nil
+}
+
+// jsonEqual compares two JSON values, ignoring the difference between integer and float numbers
+func jsonEqual(a, b interface{}) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
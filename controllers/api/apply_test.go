@@ -0,0 +1,249 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	kcore "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fromJSON returns the JSON value of the document, failing the test on invalid documents
+func fromJSON(t *testing.T, document string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		t.Fatalf("invalid test document %s: %v", document, err)
+	}
+	return value
+}
+
+func TestChangedFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		modified string
+		want     string
+	}{
+		{"unchanged", `{"a":1,"b":{"c":"x"}}`, `{"a":1,"b":{"c":"x"}}`, `{}`},
+		{"changed value", `{"a":1,"b":2}`, `{"a":1,"b":3}`, `{"b":3}`},
+		{"added field", `{"a":1}`, `{"a":1,"b":{"c":true}}`, `{"b":{"c":true}}`},
+		{"nested map", `{"spec":{"a":1,"b":2}}`, `{"spec":{"a":1,"b":3}}`, `{"spec":{"b":3}}`},
+		{"map replaced by value", `{"a":{"b":1}}`, `{"a":"b"}`, `{"a":"b"}`},
+		{"removed field is left out", `{"a":1,"b":2}`, `{"a":1}`, `{}`},
+		{"removed list becomes empty", `{"args":["a"]}`, `{}`, `{"args":[]}`},
+		{"removed associative list is left out", `{"env":[{"name":"A"}]}`, `{}`, `{}`},
+		{"atomic list is replaced", `{"args":["a","b"]}`, `{"args":["a","c"]}`, `{"args":["a","c"]}`},
+		{
+			"associative list element",
+			`{"containers":[{"name":"app","image":"nginx:1"},{"name":"sidecar","image":"envoy"}]}`,
+			`{"containers":[{"name":"app","image":"nginx:2"},{"name":"sidecar","image":"envoy"}]}`,
+			`{"containers":[{"name":"app","image":"nginx:2"}]}`,
+		},
+		{
+			"nested associative list",
+			`{"containers":[{"name":"app","env":[{"name":"A","value":"1"}]}]}`,
+			`{"containers":[{"name":"app","env":[{"name":"A","value":"1"},{"name":"B","value":"2"}]}]}`,
+			`{"containers":[{"name":"app","env":[{"name":"B","value":"2"}]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := fromJSON(t, tt.original).(map[string]interface{})
+			modified := fromJSON(t, tt.modified).(map[string]interface{})
+			got := changedFields(original, modified)
+			if want := fromJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("changedFields() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestChangedElements(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		modified string
+		keys     []string
+		want     string
+	}{
+		{"unchanged", `[{"name":"a","value":"1"}]`, `[{"name":"a","value":"1"}]`, []string{"name"}, `null`},
+		{"added element", `[{"name":"a"}]`, `[{"name":"a"},{"name":"b","value":"2"}]`, []string{"name"}, `[{"name":"b","value":"2"}]`},
+		{"changed element keeps its key", `[{"name":"a","value":"1","x":true}]`, `[{"name":"a","value":"2","x":true}]`, []string{"name"}, `[{"name":"a","value":"2"}]`},
+		{"removed element is left out", `[{"name":"a"},{"name":"b"}]`, `[{"name":"a"}]`, []string{"name"}, `null`},
+		{
+			"compound key",
+			`[{"containerPort":80,"protocol":"TCP"}]`,
+			`[{"containerPort":80,"protocol":"TCP","hostPort":80},{"containerPort":80,"protocol":"UDP"}]`,
+			[]string{"containerPort", "protocol"},
+			`[{"containerPort":80,"protocol":"TCP","hostPort":80},{"containerPort":80,"protocol":"UDP"}]`,
+		},
+		{"changed key adds an element", `[{"containerPort":80,"protocol":"TCP"}]`, `[{"containerPort":8080,"protocol":"TCP"}]`, []string{"containerPort", "protocol"}, `[{"containerPort":8080,"protocol":"TCP"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := fromJSON(t, tt.original).([]interface{})
+			modified := fromJSON(t, tt.modified).([]interface{})
+			got := changedElements(original, modified, tt.keys)
+			want, _ := fromJSON(t, tt.want).([]interface{})
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("changedElements() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestOwnedValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		obj    string
+		want   string
+	}{
+		{"owned field", `{"f:a":{},"f:b":{}}`, `{"a":1,"b":2,"c":3}`, `{"a":1,"b":2}`},
+		{"missing field is left out", `{"f:a":{},"f:b":{}}`, `{"a":1}`, `{"a":1}`},
+		{"nested fields", `{"f:spec":{"f:a":{}}}`, `{"spec":{"a":1,"b":2}}`, `{"spec":{"a":1}}`},
+		{"map without owned children is taken whole", `{"f:spec":{}}`, `{"spec":{"a":1,"b":2}}`, `{"spec":{"a":1,"b":2}}`},
+		{"empty nested map is left out", `{"f:spec":{"f:a":{}}}`, `{"spec":{"b":2}}`, `{}`},
+		{"atomic list", `{"f:args":{}}`, `{"args":["a","b"]}`, `{"args":["a","b"]}`},
+		{"non-field entries are ignored", `{".":{},"f:a":{}}`, `{"a":1}`, `{"a":1}`},
+		{
+			"associative list",
+			`{"f:containers":{"k:{\"name\":\"app\"}":{".":{},"f:image":{}}}}`,
+			`{"containers":[{"name":"app","image":"nginx","args":["a"]},{"name":"sidecar","image":"envoy"}]}`,
+			`{"containers":[{"name":"app","image":"nginx"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := fromJSON(t, tt.fields).(map[string]interface{})
+			obj := fromJSON(t, tt.obj).(map[string]interface{})
+			got := ownedValues(fields, obj)
+			if want := fromJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("ownedValues() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestOwnedElements(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		list   string
+		want   string
+	}{
+		{"owned element", `{"k:{\"name\":\"a\"}":{"f:value":{}}}`, `[{"name":"a","value":"1","x":true},{"name":"b","value":"2"}]`, `[{"name":"a","value":"1"}]`},
+		{"missing element is left out", `{"k:{\"name\":\"c\"}":{"f:value":{}}}`, `[{"name":"a","value":"1"}]`, `null`},
+		{"element without owned values is left out", `{"k:{\"name\":\"a\"}":{"f:value":{}}}`, `[{"name":"a"}]`, `null`},
+		{"compound key", `{"k:{\"containerPort\":80,\"protocol\":\"TCP\"}":{"f:hostPort":{}}}`, `[{"containerPort":80,"protocol":"TCP","hostPort":80},{"containerPort":80,"protocol":"UDP","hostPort":81}]`, `[{"containerPort":80,"protocol":"TCP","hostPort":80}]`},
+		{"invalid key is ignored", `{"k:name":{"f:value":{}}}`, `[{"name":"a","value":"1"}]`, `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := fromJSON(t, tt.fields).(map[string]interface{})
+			list := fromJSON(t, tt.list).([]interface{})
+			got := ownedElements(fields, list)
+			want, _ := fromJSON(t, tt.want).([]interface{})
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ownedElements() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestReplacedPorts(t *testing.T) {
+	original := &kcore.PodSpec{
+		Containers: []kcore.Container{
+			{Name: "app", Ports: []kcore.ContainerPort{{ContainerPort: 80}}},
+			{Name: "sidecar", Ports: []kcore.ContainerPort{{ContainerPort: 9090, Protocol: kcore.ProtocolTCP}}},
+		},
+		InitContainers: []kcore.Container{{Name: "init"}},
+	}
+	modified := original.DeepCopy()
+	modified.Containers[0].Ports[0].ContainerPort = 8080
+	modified.Containers[1].Ports[0].Protocol = ""
+	modified.Containers[1].Ports[0].HostPort = 9090
+	modified.InitContainers[0].Ports = []kcore.ContainerPort{{ContainerPort: 8080, Protocol: kcore.ProtocolTCP}}
+
+	got := replacedPorts(original, modified)
+	want := []containerPorts{
+		{list: "containers", name: "app", ports: modified.Containers[0].Ports},
+		{list: "initContainers", name: "init", ports: modified.InitContainers[0].Ports},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("replacedPorts() = %v, want %v", got, want)
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			found = found || reflect.DeepEqual(g, w)
+		}
+		if !found {
+			t.Errorf("replacedPorts() = %v, missing %v", got, w)
+		}
+	}
+}
+
+func TestWithoutPorts(t *testing.T) {
+	template := fromJSON(t, `{"spec":{
+		"containers":[
+			{"name":"app","ports":[{"containerPort":8080,"protocol":"TCP"}]},
+			{"name":"sidecar","image":"envoy","ports":[{"containerPort":9090,"protocol":"TCP"}]}
+		],
+		"initContainers":[{"name":"init","ports":[{"containerPort":8080,"protocol":"TCP"}]}]
+	}}`).(map[string]interface{})
+
+	withoutPorts(template, []containerPorts{
+		{list: "containers", name: "app"},
+		{list: "containers", name: "sidecar"},
+		{list: "initContainers", name: "init"},
+	})
+	want := fromJSON(t, `{"spec":{"containers":[{"name":"sidecar","image":"envoy"}]}}`)
+	if !reflect.DeepEqual(template, want) {
+		t.Errorf("withoutPorts() = %v, want %v", template, want)
+	}
+}
+
+func TestReleasedManagedFields(t *testing.T) {
+	entries := []metav1.ManagedFieldsEntry{
+		{Manager: "argocd-controller", Operation: metav1.ManagedFieldsOperationApply},
+		{Manager: fieldManager, Operation: metav1.ManagedFieldsOperationApply},
+		{Manager: fieldManager, Operation: metav1.ManagedFieldsOperationUpdate},
+		{Manager: revertFieldManager, Operation: metav1.ManagedFieldsOperationApply},
+		{Manager: "kube-controller-manager", Operation: metav1.ManagedFieldsOperationUpdate, Subresource: "status"},
+	}
+
+	kept, released := releasedManagedFields(entries, fieldManager, revertFieldManager)
+	if !released {
+		t.Error("releasedManagedFields() released nothing")
+	}
+	want := []metav1.ManagedFieldsEntry{entries[0], entries[4]}
+	if !reflect.DeepEqual(kept, want) {
+		t.Errorf("releasedManagedFields() = %v, want %v", kept, want)
+	}
+
+	if kept, released := releasedManagedFields(want, fieldManager, revertFieldManager); released || !reflect.DeepEqual(kept, want) {
+		t.Errorf("releasedManagedFields() = %v, %v for entries without the managers", kept, released)
+	}
+	if kept, released := releasedManagedFields(entries[1:4], fieldManager, revertFieldManager); !released || len(kept) != 0 {
+		t.Errorf("releasedManagedFields() = %v, %v for entries of only the managers", kept, released)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	kcore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+// configurationAnnotationName names the Configuration that applies to a workload,
+// either as "namespace/name" or as the name of a Configuration in the namespace of the workload
+const configurationAnnotationName = "anaisurl.com/configuration"
+
+// claimedConfiguration returns the key of the Configuration named by the workload
+func claimedConfiguration(obj client.Object) (string, bool) {
+	name, ok := obj.GetAnnotations()[configurationAnnotationName]
+	if !ok || name == "" {
+		return "", false
+	}
+	if !strings.Contains(name, "/") {
+		name = workloadKey(obj.GetNamespace(), name)
+	}
+	return name, true
+}
+
+// selectsWorkload reports whether the Configuration targets the kind of the workload and its
+// namespace and label selectors and target expression match the workload
+func (r *ConfigurationReconciler) selectsWorkload(ctx context.Context, mdConf *apiv1alpha1.Configuration, obj client.Object) (bool, error) {
+	if !targetsKind(mdConf, obj) || !selectorMatches(mdConf.Spec.Selector, obj.GetLabels()) {
+		return false, nil
+	}
+	// Failing expressions are reported by the reconciliation of the Configuration
+	if matched, err := matchesExpression(mdConf, obj); err != nil || !matched {
+		return false, nil
+	}
+	if mdConf.Spec.NamespaceSelector == nil {
+		return true, nil
+	}
+	namespace := &kcore.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: obj.GetNamespace()}, namespace); err != nil {
+		return false, err
+	}
+	return selectorMatches(mdConf.Spec.NamespaceSelector, namespace.Labels), nil
+}
+
+// claimants returns the keys of the Configurations that claim the workload. A workload that names a
+// Configuration is only claimed by it, otherwise it is claimed by every Configuration selecting it.
+func (r *ConfigurationReconciler) claimants(ctx context.Context, configurations []apiv1alpha1.Configuration, obj client.Object) ([]string, error) {
+	if name, ok := claimedConfiguration(obj); ok {
+		return []string{name}, nil
+	}
+
+	var keys []string
+	for i := range configurations {
+		mdConf := &configurations[i]
+		if !mdConf.DeletionTimestamp.IsZero() {
+			continue
+		}
+		selected, err := r.selectsWorkload(ctx, mdConf, obj)
+		if err != nil {
+			return nil, err
+		}
+		if selected {
+			keys = append(keys, configurationKey(mdConf))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// claimConflict returns why the workload is not claimed by the Configuration alone. An empty
+// reason means the Configuration may misconfigure the workload. The Configuration that is injected
+// into a workload keeps it until it is reverted, unless the workload names another Configuration.
+func claimConflict(mdConf *apiv1alpha1.Configuration, obj client.Object, claimants []string) (string, string) {
+	key := configurationKey(mdConf)
+
+	if _, named := claimedConfiguration(obj); named && (len(claimants) != 1 || claimants[0] != key) {
+		return "ClaimedByOtherConfiguration", fmt.Sprintf("Workload names Configuration %s", strings.Join(claimants, ", "))
+	}
+	if injectedBy, ok := obj.GetAnnotations()[injectedByAnnotationName]; ok {
+		if injectedBy != key {
+			return "InjectedByOtherConfiguration", fmt.Sprintf("Misconfiguration of Configuration %s is injected", injectedBy)
+		}
+		return "", ""
+	}
+	if len(claimants) > 1 {
+		return "Conflict", fmt.Sprintf("Claimed by Configurations %s, set the %s annotation to choose one", strings.Join(claimants, ", "), configurationAnnotationName)
+	}
+	return "", ""
+}
@@ -18,33 +18,63 @@ package api
 
 import (
 	"context"
-	"strings"
+	"encoding/json"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
-	kapps "k8s.io/api/apps/v1"
+	"github.com/AnaisUrlichs/security-controller/controllers/killswitch"
+	"github.com/AnaisUrlichs/security-controller/pkg/expression"
 	kcore "k8s.io/api/core/v1"
 )
 
 // ConfigurationReconciler reconciles a Configuration object
 type ConfigurationReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	// APIReader reads the objects that are not cached by the manager
+	APIReader  client.Reader
+	Log        logr.Logger
+	Scheme     *runtime.Scheme
+	KillSwitch *killswitch.KillSwitch
+
+	// Namespaces no workload is misconfigured in
+	ProtectedNamespaces []string
+
+	// controller watches the kinds patched by Configurations once they are known
+	controller     controller.Controller
+	watchedKinds   map[schema.GroupVersionKind]bool
+	watchedKindsMu sync.Mutex
 }
 
 const (
-	reconcileErrorInterval   = 10 * time.Second
-	reconcileSuccessInterval = 120 * time.Second
-	annotationName           = "anaisurl.com/misconfiguration"
+	reconcileErrorInterval      = 10 * time.Second
+	annotationName              = "anaisurl.com/misconfiguration"
+	annotationValueExpired      = "expired"
+	annotationValueSkipped      = "skipped"
+	lastUpdatedAnnotationName   = "anaisurl.com/last-updated"
+	injectionTimeAnnotationName = "anaisurl.com/injection-time"
+	resultsAnnotationName       = "anaisurl.com/misconfiguration-results"
+	snapshotAnnotationName      = "anaisurl.com/original-pod-template"
+	injectedByAnnotationName    = "anaisurl.com/injected-by"
+	configurationFinalizer      = "api.core.anaisurl.com/revert-misconfiguration"
 )
 
 // +kubebuilder:rbac:groups=api.core.anaisurl.com,resources=configurations,verbs=get;list;watch;create;update;patch;delete
@@ -52,7 +82,13 @@ const (
 // +kubebuilder:rbac:groups=api.core.anaisurl.com,resources=configurations/finalizers,verbs=update
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get;list;watch;create;update;patch;delete
-//
+// +kubebuilder:rbac:groups=apps,resources=statefulsets;daemonsets;replicasets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 //
@@ -76,64 +112,365 @@ func (r *ConfigurationReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	}
 
 	if !mdConf.ObjectMeta.DeletionTimestamp.IsZero() {
-		// Stop reconciliation as the item is being deleted
-		return r.finishReconcile(nil, false)
+		// Revert every injection before the item is deleted
+		return r.finishReconcile(r.finalize(ctx, mdConf), false)
+	}
+
+	// Revert every injection while the kill switch is engaged
+	engaged, err := r.KillSwitch.Engaged(ctx)
+	if err != nil {
+		return r.finishReconcile(err, false)
+	}
+	if engaged {
+		return r.finishReconcile(r.halt(ctx, mdConf), false)
+	}
+	setCondition(mdConf, apiv1alpha1.ConditionHalted, metav1.ConditionFalse, "KillSwitchReleased", "")
+
+	if controllerutil.AddFinalizer(mdConf, configurationFinalizer) {
+		if err := r.Update(ctx, mdConf); err != nil {
+			return r.finishReconcile(err, false)
+		}
+	}
+
+	if mdConf.Spec.Revert {
+		return r.finishReconcile(r.revert(ctx, mdConf), false)
+	}
+
+	// Revert the deployments whose misconfiguration expired or whose rollout failed
+	var updateErrors []error
+	var untilRolloutCheck time.Duration
+	if mdConf.Spec.Suspend && mdConf.Spec.RevertOnSuspend {
+		if err := r.revertInjections(ctx, mdConf); err != nil {
+			updateErrors = append(updateErrors, err)
+		}
+	} else if !mdConf.Spec.DryRun {
+		if err := r.expireInjections(ctx, mdConf); err != nil {
+			updateErrors = append(updateErrors, err)
+		}
+		inProgress, err := r.guardRollouts(ctx, mdConf)
+		if err != nil {
+			updateErrors = append(updateErrors, err)
+		}
+		if inProgress {
+			untilRolloutCheck = rolloutCheckInterval
+		}
 	}
 
-	// Get list of deployments
-	deploymentList := &kapps.DeploymentList{}
-	var mdDeploymentList []kapps.Deployment
+	if mdConf.Spec.Suspend {
+		// Stop injecting until the Configuration is unsuspended
+		mdConf.Status.NextScheduledTime = nil
+		err := r.updateStatus(ctx, mdConf, kerrors.NewAggregate(updateErrors))
+		return r.finishReconcileAfter(err, nextExpiry(mdConf), untilRolloutCheck)
+	}
 
-	if err := r.List(ctx, deploymentList); err != nil {
+	// Check whether a scheduled run is due
+	scheduledRunDue := false
+	var untilNextRun time.Duration
+	if mdConf.Spec.Schedule != "" {
+		due, next, err := scheduledRun(ctx, mdConf, time.Now())
+		if err != nil {
+			return r.finishReconcile(r.updateStatus(ctx, mdConf, err), false)
+		}
+		if due != nil {
+			scheduledRunDue = true
+			mdConf.Status.LastRunTime = &metav1.Time{Time: *due}
+		}
+		mdConf.Status.NextScheduledTime = &metav1.Time{Time: next}
+		untilNextRun = time.Until(next)
+	}
+
+	// Target expressions are validated on admission, unless the webhook is disabled
+	if mdConf.Spec.TargetExpression != "" {
+		if _, err := expression.Compile(mdConf.Spec.TargetExpression); err != nil {
+			err = fmt.Errorf("invalid target expression: %w", err)
+			return r.finishReconcile(r.updateStatus(ctx, mdConf, err), false)
+		}
+	}
+
+	// Get list of workloads selected by the Configuration
+	workloads, err := r.listWorkloads(ctx, mdConf)
+	if err != nil {
+		return r.finishReconcile(r.updateStatus(ctx, mdConf, err), false)
+	}
+
+	// Other Configurations may claim the same workloads
+	configurationList := &apiv1alpha1.ConfigurationList{}
+	if err := r.List(ctx, configurationList); err != nil {
 		return r.finishReconcile(err, false)
 	}
 
-	cmExists := false
-	// Get list of deployments with annotation
-	for _, cm := range deploymentList.Items {
-		val, ok := cm.GetAnnotations()["anaisurl.com/misconfiguration"]
-		if ok && val == "true" {
-			cmExists = true
-			mdDeploymentList = append(mdDeploymentList, cm)
-		}
-	}
-
-	if cmExists == true {
-		for _, cm := range mdDeploymentList {
-
-			err := r.Get(ctx, types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, &cm)
-			deploymentStatus := cm.Status.Conditions[0].Type
-
-			// Update Deployment Spec
-			log.Info("Reconciling deployments" + cm.Name)
-			if err != nil && errors.IsNotFound(err) {
-				log.V(1).Info("Deplpyment is not found")
-				return r.finishReconcile(err, true)
-			} else if err == nil && deploymentStatus == "Available" {
-				cm.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort = mdConf.Spec.ContainerPort
-				cm.Spec.Template.Spec.Containers[0].Image = strings.Split(cm.Spec.Template.Spec.Containers[0].Image, ":")[0] + ":" + mdConf.Spec.ImageTag
-				cm.Spec.Template.Spec.Containers[0].SecurityContext.AllowPrivilegeEscalation = &mdConf.Spec.AllowPrivilegeEscalation
-				cm.Spec.Template.Spec.Containers[0].SecurityContext.RunAsNonRoot = &mdConf.Spec.RunAsNonRoot
-				cm.Spec.Template.Spec.Containers[0].SecurityContext.ReadOnlyRootFilesystem = &mdConf.Spec.ReadOnlyRootFilesystem
-				cm.Spec.Template.Spec.Containers[0].Resources.Requests[kcore.ResourceCPU] = mdConf.Spec.CPURequests
-				cm.Spec.Template.Spec.Containers[0].Resources.Limits[kcore.ResourceCPU] = mdConf.Spec.CPULimits
-				cm.Spec.Template.Spec.Containers[0].Resources.Requests[kcore.ResourceMemory] = mdConf.Spec.MemoryRequests
-				cm.Spec.Template.Spec.Containers[0].Resources.Limits[kcore.ResourceMemory] = mdConf.Spec.MemoryLimits
-
-				cm.Annotations["anaisurl.com/last-updated"] = time.Now().Format(time.RFC3339)
-				cm.Annotations["anaisurl.com/misconfiguration"] = "false"
-
-				err := r.Client.Update(ctx, &cm)
-				if err != nil {
-					r.finishReconcile(err, true)
+	annotated := map[string]bool{}
+	injected := 0
+	var targets []client.Object
+	var skipped, ineligible []apiv1alpha1.SkippedWorkload
+	for _, obj := range workloads {
+		// Workloads managed by another workload, e.g. the ReplicaSets of a Deployment,
+		// inherit its annotations and are misconfigured through it
+		if metav1.GetControllerOf(obj) != nil {
+			continue
+		}
+
+		val, ok := obj.GetAnnotations()[annotationName]
+		if !ok {
+			// The experiment ended once the annotation is removed, restore the original pod template.
+			// Workloads without a snapshot were never injected and are left untouched.
+			injectedBy, injected := obj.GetAnnotations()[injectedByAnnotationName]
+			if mdConf.Spec.DryRun || (injected && injectedBy != configurationKey(mdConf)) || (!injected && !hasSnapshot(obj)) {
+				continue
+			}
+			if _, err := r.revertWorkload(ctx, obj); err != nil {
+				updateErrors = append(updateErrors, err)
+			}
+			continue
+		}
+
+		matched, err := matchesExpression(mdConf, obj)
+		if err != nil {
+			ineligible = append(ineligible, skippedWorkload(obj, "TargetExpressionFailed", err.Error()))
+		}
+		if !matched {
+			// The workload no longer matches the target expression, restore it
+			if obj.GetAnnotations()[injectedByAnnotationName] == configurationKey(mdConf) && !mdConf.Spec.DryRun {
+				if _, err := r.revertWorkload(ctx, obj); err != nil {
+					updateErrors = append(updateErrors, err)
 				}
 			}
+			continue
+		}
+
+		reason, message, err := r.protection(ctx, obj)
+		if err != nil {
+			updateErrors = append(updateErrors, err)
+			continue
+		}
+		if reason != "" {
+			ineligible = append(ineligible, skippedWorkload(obj, reason, message))
+			// The workload was protected after the injection, restore it
+			if obj.GetAnnotations()[injectedByAnnotationName] == configurationKey(mdConf) && !mdConf.Spec.DryRun {
+				if _, err := r.revertWorkload(ctx, obj); err != nil {
+					updateErrors = append(updateErrors, err)
+				}
+			}
+			continue
+		}
+
+		claimants, err := r.claimants(ctx, configurationList.Items, obj)
+		if err != nil {
+			updateErrors = append(updateErrors, err)
+			continue
 		}
-	} else {
-		return ctrl.Result{}, nil
+		if reason, message := claimConflict(mdConf, obj, claimants); reason != "" {
+			ineligible = append(ineligible, skippedWorkload(obj, reason, message))
+			// The workload chose another Configuration, restore it for the new one
+			if obj.GetAnnotations()[injectedByAnnotationName] == configurationKey(mdConf) && !mdConf.Spec.DryRun {
+				if _, err := r.revertWorkload(ctx, obj); err != nil {
+					updateErrors = append(updateErrors, err)
+				}
+			}
+			continue
+		}
+		annotated[objectKey(obj)] = true
+
+		// Injected workloads stay injected until they are reverted and count against the blast radius
+		if obj.GetAnnotations()[injectedByAnnotationName] == configurationKey(mdConf) {
+			injected++
+			continue
+		}
+
+		// Without a schedule, workloads with the annotation set to "true" are misconfigured.
+		// A scheduled run misconfigures every annotated workload whose rollout did not fail.
+		due := val == "true"
+		if mdConf.Spec.Schedule != "" {
+			due = scheduledRunDue && val != annotationValueFailed
+		}
+		if !due {
+			continue
+		}
+		// The readiness of patched resources is unknown
+		if _, patched := obj.(*unstructured.Unstructured); !patched {
+			kind := kindOf(obj)
+			if kind.immutableTemplate {
+				ineligible = append(ineligible, skippedWorkload(obj, "ImmutablePodTemplate",
+					fmt.Sprintf("The pod template of a %s cannot be changed", kind.gvk.Kind)))
+				continue
+			}
+			if reason, message := kind.notReady(mdConf.Spec.ReadinessGate, obj); reason != "" {
+				ineligible = append(ineligible, skippedWorkload(obj, reason, message))
+				continue
+			}
+		}
+		targets = append(targets, obj)
 	}
 
-	return ctrl.Result{}, nil
+	if len(targets) > 0 {
+		// Pick a random subset of the targets
+		mdConf.Status.SamplingSeed = nil
+		if sampling := mdConf.Spec.Sampling; sampling != nil {
+			seed := time.Now().UnixNano()
+			if sampling.Seed != nil {
+				seed = *sampling.Seed
+			}
+			var notSampled []client.Object
+			targets, notSampled, err = sampleTargets(sampling, targets, seed)
+			if err != nil {
+				return r.finishReconcile(r.updateStatus(ctx, mdConf, err), false)
+			}
+			for _, obj := range notSampled {
+				skipped = append(skipped, skippedWorkload(obj, "NotSampled", "Not picked by the random sampling"))
+			}
+			// Sample once per run, the workloads that were not picked wait for the next run
+			if !mdConf.Spec.DryRun {
+				if err := r.markSkipped(ctx, notSampled); err != nil {
+					updateErrors = append(updateErrors, err)
+				}
+			}
+			mdConf.Status.SamplingSeed = &seed
+		}
+
+		// Limit the blast radius of the experiment
+		var limited []client.Object
+		targets, limited = limitTargets(&mdConf.Spec, targets, len(annotated), injected)
+		for _, obj := range limited {
+			skipped = append(skipped, skippedWorkload(obj, "BlastRadiusLimit", "Maximum number of targets reached"))
+		}
+		if !mdConf.Spec.DryRun {
+			if err := r.markSkipped(ctx, limited); err != nil {
+				updateErrors = append(updateErrors, err)
+			}
+		}
+
+		mdConf.Status.SelectedWorkloads = nil
+	}
+	if len(targets) > 0 || len(ineligible) > 0 {
+		mdConf.Status.SkippedWorkloads = append(ineligible, skipped...)
+	}
+	setConflictCondition(mdConf, ineligible)
+
+	if mdConf.Spec.DryRun {
+		// Report what would be changed without updating any workload
+		var results []apiv1alpha1.DryRunResult
+		for _, obj := range targets {
+			mdConf.Status.SelectedWorkloads = append(mdConf.Status.SelectedWorkloads, workloadReference(obj))
+			var result *apiv1alpha1.DryRunResult
+			if u, patched := obj.(*unstructured.Unstructured); patched {
+				result, err = r.dryRunPatch(ctx, mdConf, u)
+			} else {
+				result, err = dryRunMisconfiguration(mdConf, obj)
+			}
+			if err != nil {
+				updateErrors = append(updateErrors, err)
+				continue
+			}
+			results = append(results, *result)
+		}
+		if len(targets) > 0 {
+			if err := r.storeDryRunResults(ctx, mdConf, results); err != nil {
+				updateErrors = append(updateErrors, err)
+			}
+		}
+		targets = nil
+	} else if len(targets) > 0 {
+		mdConf.Status.DryRunResults = nil
+		mdConf.Status.DryRunConfigMap = ""
+	}
+
+	for _, obj := range targets {
+		mdConf.Status.SelectedWorkloads = append(mdConf.Status.SelectedWorkloads, workloadReference(obj))
+
+		// Update the pod template of the workload or patch the resource
+		log.Info("Reconciling workload", "kind", kindName(obj), "name", obj.GetName(), "namespace", obj.GetNamespace())
+		workload, err := r.injectMisconfiguration(ctx, mdConf, obj)
+		if err != nil {
+			log.Error(err, "Failed to misconfigure workload", "kind", kindName(obj), "name", obj.GetName(), "namespace", obj.GetNamespace())
+			updateErrors = append(updateErrors, err)
+			continue
+		}
+		setAffectedWorkload(&mdConf.Status, *workload)
+		removeFailedWorkload(&mdConf.Status, workload.Kind, workload.Namespace, workload.Name)
+		now := metav1.Now()
+		mdConf.Status.LastInjectionTime = &now
+		setCondition(mdConf, apiv1alpha1.ConditionReverted, metav1.ConditionFalse, "Injected", "")
+	}
+
+	// Workloads which were deleted or left the experiment are no longer affected
+	pruneAffectedWorkloads(&mdConf.Status, annotated)
+
+	err = r.updateStatus(ctx, mdConf, kerrors.NewAggregate(updateErrors))
+
+	// Requeue when the next injection expires, the next run is scheduled or a rollout is watched
+	return r.finishReconcileAfter(err, nextExpiry(mdConf), untilNextRun, untilRolloutCheck)
+}
+
+// markSkipped marks the workloads left out of the run, so they are not misconfigured before the next
+// scheduled run or until their annotation is set back to "true"
+func (r *ConfigurationReconciler) markSkipped(ctx context.Context, workloads []client.Object) error {
+	var markErrors []error
+	for _, obj := range workloads {
+		if err := r.mergeAnnotations(ctx, obj, map[string]interface{}{annotationName: annotationValueSkipped}); err != nil {
+			markErrors = append(markErrors, fmt.Errorf("failed to mark %s as skipped: %w", objectKey(obj), err))
+		}
+	}
+	return kerrors.NewAggregate(markErrors)
+}
+
+// injectMisconfiguration applies the misconfiguration to a workload and returns the affected workload
+func (r *ConfigurationReconciler) injectMisconfiguration(ctx context.Context, mdConf *apiv1alpha1.Configuration, obj client.Object) (*apiv1alpha1.AffectedWorkload, error) {
+	if u, patched := obj.(*unstructured.Unstructured); patched {
+		return r.injectPatch(ctx, mdConf, u)
+	}
+	log := log.FromContext(ctx)
+	kind := kindOf(obj)
+
+	original, snapshot, err := originalPodTemplate(obj.GetAnnotations(), kind.podTemplate(obj))
+	if err != nil {
+		return nil, err
+	}
+
+	misconfigured := original.DeepCopy()
+	results := applyMisconfiguration(misconfigured, &mdConf.Spec)
+	if len(results.Pod) > 0 {
+		log.Info("Misconfigured pod", "workload", objectKey(obj), "fields", results.Pod)
+	}
+	for _, result := range results.Containers {
+		log.Info("Misconfigured container", "workload", objectKey(obj), "container", result.Name, "initContainer", result.InitContainer, "fields", result.Fields)
+	}
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	template, err := podTemplateChanges(original, misconfigured)
+	if err != nil {
+		return nil, err
+	}
+	replaced := replacedPorts(&kind.podTemplate(obj).Spec, &misconfigured.Spec)
+	withoutPorts(template, replaced)
+
+	now := metav1.Now()
+	injectionTime := firstInjectionTime(obj, now)
+	intent := applyIntent(kind.gvk, obj, map[string]string{
+		annotationName:              "false",
+		lastUpdatedAnnotationName:   now.Format(time.RFC3339),
+		injectionTimeAnnotationName: injectionTime.Format(time.RFC3339),
+		resultsAnnotationName:       string(resultsJSON),
+		injectedByAnnotationName:    configurationKey(mdConf),
+		snapshotAnnotationName:      snapshot,
+	}, kind.nestedTemplate(template))
+
+	if err := r.apply(ctx, intent, fieldManager); err != nil {
+		return nil, err
+	}
+	if err := r.replacePorts(ctx, obj, replaced, fieldManager); err != nil {
+		return nil, err
+	}
+
+	return &apiv1alpha1.AffectedWorkload{
+		Kind:          kind.gvk.Kind,
+		Namespace:     obj.GetNamespace(),
+		Name:          obj.GetName(),
+		Fields:        results.Pod,
+		Containers:    results.Containers,
+		InjectionTime: injectionTime,
+	}, nil
 }
 
 func (r *ConfigurationReconciler) finishReconcile(err error, requeueImmediate bool) (ctrl.Result, error) {
@@ -145,18 +482,52 @@ func (r *ConfigurationReconciler) finishReconcile(err error, requeueImmediate bo
 		r.Log.Error(err, "Finished Reconciling Deployments with error: %w")
 		return ctrl.Result{Requeue: true, RequeueAfter: interval}, err
 	}
-	interval := reconcileSuccessInterval
-	if requeueImmediate {
-		interval = 0
-	}
+	// Changes of the selected workloads trigger the next reconciliation
 	r.Log.Info("Finished Reconciling Deployment")
-	return ctrl.Result{Requeue: true, RequeueAfter: interval}, nil
+	return ctrl.Result{Requeue: requeueImmediate}, nil
+}
+
+// finishReconcileAfter finishes the reconciliation like finishReconcile, but requeues after the
+// shortest of the intervals
+func (r *ConfigurationReconciler) finishReconcileAfter(err error, intervals ...time.Duration) (ctrl.Result, error) {
+	result, err := r.finishReconcile(err, false)
+	if err != nil {
+		return result, err
+	}
+	for _, interval := range intervals {
+		if interval > 0 && (result.RequeueAfter == 0 || interval < result.RequeueAfter) {
+			result.RequeueAfter = interval
+		}
+	}
+	return result, err
 }
 
 // SetupWithManager sets up the controller with the Manager in main.go
 func (r *ConfigurationReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&apiv1alpha1.Configuration{}).
-		Owns(&kapps.Deployment{}).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&apiv1alpha1.Configuration{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &apiv1alpha1.Configuration{}},
+			handler.EnqueueRequestsFromMapFunc(r.configurationsForConfiguration),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	for _, kind := range workloadKinds {
+		b = b.Watches(&source.Kind{Type: kind.newObject()},
+			handler.EnqueueRequestsFromMapFunc(r.configurationsForWorkload),
+			builder.WithPredicates(annotatedWorkload))
+	}
+	c, err := b.
+		Watches(&source.Kind{Type: &kcore.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.allConfigurations),
+			builder.WithPredicates(r.KillSwitch.Predicate())).
+		Watches(&source.Kind{Type: &kcore.Namespace{}},
+			handler.EnqueueRequestsFromMapFunc(r.allConfigurations),
+			builder.WithPredicates(predicate.Or(predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Build(r)
+	if err != nil {
+		return err
+	}
+
+	r.watchedKindsMu.Lock()
+	defer r.watchedKindsMu.Unlock()
+	r.controller = c
+	return nil
 }
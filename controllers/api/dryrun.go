@@ -0,0 +1,111 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"gomodules.xyz/jsonpatch/v2"
+	kcore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+// dryRunDiffLimit is the total size of the diffs above which they are stored in a ConfigMap instead of the status
+const dryRunDiffLimit = 16 * 1024
+
+// dryRunMisconfiguration computes the misconfiguration of a workload without changing it
+func dryRunMisconfiguration(mdConf *apiv1alpha1.Configuration, obj client.Object) (*apiv1alpha1.DryRunResult, error) {
+	misconfigured := obj.DeepCopyObject().(client.Object)
+	results := applyMisconfiguration(kindOf(misconfigured).podTemplate(misconfigured), &mdConf.Spec)
+
+	original, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	modified, err := json.Marshal(misconfigured)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.CreatePatch(original, modified)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1alpha1.DryRunResult{
+		WorkloadReference: workloadReference(obj),
+		Fields:            results.Pod,
+		Containers:        results.Containers,
+		Diff:              string(diff),
+	}, nil
+}
+
+// storeDryRunResults records the dry run results in the status. When the diffs are too large for
+// the status, they are moved to a ConfigMap owned by the Configuration.
+func (r *ConfigurationReconciler) storeDryRunResults(ctx context.Context, mdConf *apiv1alpha1.Configuration, results []apiv1alpha1.DryRunResult) error {
+	size := 0
+	for _, result := range results {
+		size += len(result.Diff)
+	}
+
+	mdConf.Status.DryRunResults = results
+	mdConf.Status.DryRunConfigMap = ""
+	if size <= dryRunDiffLimit {
+		return nil
+	}
+
+	// ConfigMaps are not cached by the manager, so the ConfigMap is read from the API server
+	configMap := &kcore.ConfigMap{}
+	key := types.NamespacedName{Namespace: mdConf.Namespace, Name: mdConf.Name + "-dry-run"}
+	err := r.APIReader.Get(ctx, key, configMap)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	configMap.Namespace, configMap.Name = key.Namespace, key.Name
+	configMap.Data = map[string]string{}
+	for _, result := range results {
+		configMap.Data[strings.ToLower(result.Kind)+"."+result.Namespace+"."+result.Name+".json"] = result.Diff
+	}
+	if err := controllerutil.SetControllerReference(mdConf, configMap, r.Scheme); err != nil {
+		return err
+	}
+	if exists {
+		err = r.Update(ctx, configMap)
+	} else {
+		err = r.Create(ctx, configMap)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range mdConf.Status.DryRunResults {
+		mdConf.Status.DryRunResults[i].Diff = ""
+	}
+	mdConf.Status.DryRunConfigMap = configMap.Name
+	return nil
+}
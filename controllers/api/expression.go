@@ -0,0 +1,100 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+	"github.com/AnaisUrlichs/security-controller/pkg/expression"
+)
+
+// expressionObject returns the workload as the object target expressions are evaluated against
+func expressionObject(obj client.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.Object, nil
+	}
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	// Typed workloads read through the client do not carry their kind
+	kind := kindOf(obj)
+	object["apiVersion"] = kind.gvk.GroupVersion().String()
+	object["kind"] = kind.gvk.Kind
+	return object, nil
+}
+
+// originalObject returns the workload as it was before the injection, restored from its snapshot
+func originalObject(obj client.Object) (client.Object, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		snapshot, ok := u.GetAnnotations()[originalObjectAnnotationName]
+		if !ok {
+			return obj, nil
+		}
+		content := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(snapshot), &content); err != nil {
+			return nil, fmt.Errorf("invalid resource snapshot: %w", err)
+		}
+		for _, field := range []string{"apiVersion", "kind", "metadata", "status"} {
+			if value, ok := u.Object[field]; ok {
+				content[field] = runtime.DeepCopyJSONValue(value)
+			}
+		}
+		return &unstructured.Unstructured{Object: content}, nil
+	}
+
+	original := obj.DeepCopyObject().(client.Object)
+	template := kindOf(original).podTemplate(original)
+	snapshot, _, err := originalPodTemplate(original.GetAnnotations(), template)
+	if err != nil {
+		return nil, err
+	}
+	*template = *snapshot
+	return original, nil
+}
+
+// matchesExpression reports whether the target expression of the Configuration returns true for
+// the workload. Configurations without a target expression match every workload. Workloads injected
+// by the Configuration are evaluated as they were before the injection, so the misconfiguration does
+// not decide whether they are still targeted.
+func matchesExpression(mdConf *apiv1alpha1.Configuration, obj client.Object) (bool, error) {
+	if mdConf.Spec.TargetExpression == "" {
+		return true, nil
+	}
+	program, err := expression.Compile(mdConf.Spec.TargetExpression)
+	if err != nil {
+		return false, fmt.Errorf("invalid target expression: %w", err)
+	}
+	if obj.GetAnnotations()[injectedByAnnotationName] == configurationKey(mdConf) {
+		original, err := originalObject(obj)
+		if err != nil {
+			return false, err
+		}
+		obj = original
+	}
+	object, err := expressionObject(obj)
+	if err != nil {
+		return false, err
+	}
+	return expression.Matches(program, object)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	kapps "k8s.io/api/apps/v1"
+	kcore "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+func TestMatchesExpression(t *testing.T) {
+	mdConf := &apiv1alpha1.Configuration{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "experiment"},
+		Spec:       apiv1alpha1.ConfigurationSpec{TargetExpression: `!has(object.spec.template.spec.hostNetwork)`},
+	}
+	original := kcore.PodTemplateSpec{Spec: kcore.PodSpec{Containers: []kcore.Container{{Name: "app"}}}}
+	snapshot, err := json.Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	misconfigured := original.DeepCopy()
+	misconfigured.Spec.HostNetwork = true
+
+	deployment := func(template kcore.PodTemplateSpec, annotations map[string]string) client.Object {
+		return &kapps.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Annotations: annotations},
+			Spec:       kapps.DeploymentSpec{Template: template},
+		}
+	}
+	ingress := func(host string, annotations map[string]string) client.Object {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "Ingress",
+			"spec":       map[string]interface{}{"host": host},
+		}}
+		u.SetNamespace("default")
+		u.SetName("app")
+		u.SetAnnotations(annotations)
+		return u
+	}
+	ingressConf := mdConf.DeepCopy()
+	ingressConf.Spec.TargetExpression = `object.spec.host.endsWith(".example.com")`
+
+	tests := []struct {
+		name   string
+		mdConf *apiv1alpha1.Configuration
+		obj    client.Object
+		want   bool
+	}{
+		{"not injected", mdConf, deployment(original, nil), true},
+		{"misconfigured by another change", mdConf, deployment(*misconfigured, nil), false},
+		{"injected by the Configuration", mdConf, deployment(*misconfigured, map[string]string{
+			injectedByAnnotationName: "default/experiment",
+			snapshotAnnotationName:   string(snapshot),
+		}), true},
+		{"injected by another Configuration", mdConf, deployment(*misconfigured, map[string]string{
+			injectedByAnnotationName: "default/other",
+			snapshotAnnotationName:   string(snapshot),
+		}), false},
+		{"patched resource", ingressConf, ingress("app.example.com", nil), true},
+		{"resource patched by the Configuration", ingressConf, ingress("app.invalid", map[string]string{
+			injectedByAnnotationName:     "default/experiment",
+			originalObjectAnnotationName: `{"spec":{"host":"app.example.com"}}`,
+		}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchesExpression(tt.mdConf, tt.obj)
+			if err != nil {
+				t.Fatalf("matchesExpression() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("matchesExpression() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	kcore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+const (
+	// appArmorAnnotationPrefix is the pod template annotation prefix setting the AppArmor profile of a container
+	appArmorAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io/"
+	// injectedVolumePrefix prefixes the names of the volumes injected by the operator
+	injectedVolumePrefix = "misconfiguration-"
+	// containerPortField is the field recorded when the port of a container is changed
+	containerPortField = "ports[0].containerPort"
+)
+
+// misconfigurationResults records what was changed on a pod template
+type misconfigurationResults struct {
+	Pod        []string                      `json:"pod,omitempty"`
+	Containers []apiv1alpha1.ContainerResult `json:"containers,omitempty"`
+}
+
+// applyMisconfiguration applies the misconfiguration to the pod spec and to every container of the
+// pod template matched by the container selector and returns what was changed
+func applyMisconfiguration(template *kcore.PodTemplateSpec, spec *apiv1alpha1.ConfigurationSpec) misconfigurationResults {
+	var results misconfigurationResults
+	podSpec := &template.Spec
+
+	// previously injected volumes are replaced by the ones currently configured
+	removeInjectedVolumes(podSpec)
+
+	results.Pod = applyPodSecurity(podSpec, spec)
+	results.Pod = append(results.Pod, injectVolumes(podSpec, spec.Volumes)...)
+
+	for _, i := range selectContainers(podSpec.Containers, spec.Containers) {
+		c := &podSpec.Containers[i]
+		fields := misconfigureContainer(c, spec)
+		fields = append(fields, setAppArmorProfile(template, c.Name, spec)...)
+		results.Containers = append(results.Containers, apiv1alpha1.ContainerResult{
+			Name:   c.Name,
+			Fields: fields,
+		})
+	}
+
+	if spec.Containers != nil && spec.Containers.IncludeInitContainers {
+		for _, i := range selectContainers(podSpec.InitContainers, spec.Containers) {
+			c := &podSpec.InitContainers[i]
+			fields := misconfigureContainer(c, spec)
+			fields = append(fields, setAppArmorProfile(template, c.Name, spec)...)
+			results.Containers = append(results.Containers, apiv1alpha1.ContainerResult{
+				Name:          c.Name,
+				InitContainer: true,
+				Fields:        fields,
+			})
+		}
+	}
+
+	return results
+}
+
+// selectContainers returns the indexes of the containers matched by the selector.
+// Without a selector only the first container is matched.
+func selectContainers(containers []kcore.Container, selector *apiv1alpha1.ContainerSelector) []int {
+	var selected []int
+
+	if selector == nil || len(selector.Names) == 0 {
+		if len(containers) > 0 {
+			selected = append(selected, 0)
+		}
+		return selected
+	}
+
+	for i, c := range containers {
+		for _, pattern := range selector.Names {
+			if containerNameMatches(pattern, c.Name) {
+				selected = append(selected, i)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// containerNameMatches reports whether the container name matches a name, glob pattern or "all"
+func containerNameMatches(pattern, name string) bool {
+	if pattern == "all" || pattern == "*" {
+		return true
+	}
+	matched, err := path.Match(pattern, name)
+	if err != nil {
+		// invalid patterns are compared literally
+		return pattern == name
+	}
+	return matched
+}
+
+// misconfigureContainer applies the misconfiguration to a single container and returns the changed fields
+func misconfigureContainer(c *kcore.Container, spec *apiv1alpha1.ConfigurationSpec) []string {
+	var fields []string
+
+	if spec.PodSecurity != nil {
+		fields = append(fields, bindHostPorts(c, spec.PodSecurity.HostPorts)...)
+	}
+
+	if spec.ContainerPort != nil {
+		if len(c.Ports) > 0 {
+			c.Ports[0].ContainerPort = *spec.ContainerPort
+		} else {
+			c.Ports = append(c.Ports, kcore.ContainerPort{ContainerPort: *spec.ContainerPort, Protocol: kcore.ProtocolTCP})
+		}
+		fields = append(fields, containerPortField)
+	}
+
+	if spec.ImageTag != nil {
+		c.Image = imageWithTag(c.Image, *spec.ImageTag)
+		fields = append(fields, "image")
+	}
+
+	fields = append(fields, misconfigureSecurityContext(c, spec)...)
+	fields = append(fields, mountVolumes(c, spec.Volumes)...)
+
+	resources := []struct {
+		field    string
+		list     *kcore.ResourceList
+		name     kcore.ResourceName
+		quantity *resource.Quantity
+	}{
+		{"resources.requests.cpu", &c.Resources.Requests, kcore.ResourceCPU, spec.CPURequests},
+		{"resources.limits.cpu", &c.Resources.Limits, kcore.ResourceCPU, spec.CPULimits},
+		{"resources.requests.memory", &c.Resources.Requests, kcore.ResourceMemory, spec.MemoryRequests},
+		{"resources.limits.memory", &c.Resources.Limits, kcore.ResourceMemory, spec.MemoryLimits},
+	}
+	for _, res := range resources {
+		if res.quantity == nil {
+			continue
+		}
+		if *res.list == nil {
+			*res.list = kcore.ResourceList{}
+		}
+		(*res.list)[res.name] = res.quantity.DeepCopy()
+		fields = append(fields, res.field)
+	}
+
+	return fields
+}
+
+// applyPodSecurity applies the pod level misconfiguration and returns the changed fields
+func applyPodSecurity(podSpec *kcore.PodSpec, spec *apiv1alpha1.ConfigurationSpec) []string {
+	var fields []string
+	podSecurity := spec.PodSecurity
+	if podSecurity == nil {
+		return fields
+	}
+
+	if podSecurity.HostNetwork != nil {
+		podSpec.HostNetwork = *podSecurity.HostNetwork
+		fields = append(fields, "hostNetwork")
+	}
+	if podSecurity.HostPID != nil {
+		podSpec.HostPID = *podSecurity.HostPID
+		fields = append(fields, "hostPID")
+	}
+	if podSecurity.HostIPC != nil {
+		podSpec.HostIPC = *podSecurity.HostIPC
+		fields = append(fields, "hostIPC")
+	}
+	if podSecurity.ShareProcessNamespace != nil {
+		podSpec.ShareProcessNamespace = podSecurity.ShareProcessNamespace
+		fields = append(fields, "shareProcessNamespace")
+	}
+	if podSecurity.AutomountServiceAccountToken != nil {
+		podSpec.AutomountServiceAccountToken = podSecurity.AutomountServiceAccountToken
+		fields = append(fields, "automountServiceAccountToken")
+	}
+
+	return fields
+}
+
+// bindHostPorts binds the matching container ports to ports on the host and returns the changed fields
+func bindHostPorts(c *kcore.Container, bindings []apiv1alpha1.HostPortBinding) []string {
+	var fields []string
+
+	for _, binding := range bindings {
+		for i := range c.Ports {
+			if c.Ports[i].ContainerPort != binding.ContainerPort {
+				continue
+			}
+			hostPort := binding.ContainerPort
+			if binding.HostPort != nil {
+				hostPort = *binding.HostPort
+			}
+			c.Ports[i].HostPort = hostPort
+			fields = append(fields, fmt.Sprintf("ports[%d].hostPort", i))
+		}
+	}
+	return fields
+}
+
+// injectVolumes adds the hostPath volumes to the pod spec and returns the changed fields
+func injectVolumes(podSpec *kcore.PodSpec, volumes []apiv1alpha1.HostPathVolume) []string {
+	var fields []string
+
+	for _, volume := range volumes {
+		podSpec.Volumes = append(podSpec.Volumes, kcore.Volume{
+			Name: injectedVolumePrefix + volume.Name,
+			VolumeSource: kcore.VolumeSource{
+				HostPath: &kcore.HostPathVolumeSource{
+					Path: volume.Path,
+					Type: volume.Type,
+				},
+			},
+		})
+		fields = append(fields, "volumes."+injectedVolumePrefix+volume.Name)
+	}
+	return fields
+}
+
+// mountVolumes mounts the injected hostPath volumes into the container and returns the changed fields.
+// Volumes are not mounted where the container already has a mount at the same path.
+func mountVolumes(c *kcore.Container, volumes []apiv1alpha1.HostPathVolume) []string {
+	var fields []string
+
+	for _, volume := range volumes {
+		mountPath := volume.MountPath
+		if mountPath == "" {
+			mountPath = volume.Path
+		}
+		if hasMountPath(c.VolumeMounts, mountPath) {
+			continue
+		}
+		c.VolumeMounts = append(c.VolumeMounts, kcore.VolumeMount{
+			Name:      injectedVolumePrefix + volume.Name,
+			MountPath: mountPath,
+			ReadOnly:  !volume.ReadWrite,
+		})
+		fields = append(fields, "volumeMounts."+injectedVolumePrefix+volume.Name)
+	}
+	return fields
+}
+
+// removeInjectedVolumes removes the injected volumes and their mounts from the pod spec
+// and reports whether anything was removed
+func removeInjectedVolumes(podSpec *kcore.PodSpec) bool {
+	removed := false
+
+	var volumes []kcore.Volume
+	for _, volume := range podSpec.Volumes {
+		if strings.HasPrefix(volume.Name, injectedVolumePrefix) {
+			removed = true
+			continue
+		}
+		volumes = append(volumes, volume)
+	}
+	podSpec.Volumes = volumes
+
+	for _, containers := range [][]kcore.Container{podSpec.Containers, podSpec.InitContainers} {
+		for i := range containers {
+			var mounts []kcore.VolumeMount
+			for _, mount := range containers[i].VolumeMounts {
+				if strings.HasPrefix(mount.Name, injectedVolumePrefix) {
+					removed = true
+					continue
+				}
+				mounts = append(mounts, mount)
+			}
+			containers[i].VolumeMounts = mounts
+		}
+	}
+	return removed
+}
+
+func hasMountPath(mounts []kcore.VolumeMount, mountPath string) bool {
+	for _, mount := range mounts {
+		if mount.MountPath == mountPath {
+			return true
+		}
+	}
+	return false
+}
+
+// misconfigureSecurityContext applies the optional securityContext misconfiguration and returns the changed fields
+func misconfigureSecurityContext(c *kcore.Container, spec *apiv1alpha1.ConfigurationSpec) []string {
+	var fields []string
+
+	if spec.AllowPrivilegeEscalation == nil && spec.ReadOnlyRootFilesystem == nil && spec.RunAsNonRoot == nil &&
+		spec.Privileged == nil && spec.Capabilities == nil && spec.RunAsUser == nil &&
+		spec.SeccompProfile == nil && spec.ProcMount == nil {
+		return fields
+	}
+	if c.SecurityContext == nil {
+		c.SecurityContext = &kcore.SecurityContext{}
+	}
+	sc := c.SecurityContext
+
+	if spec.AllowPrivilegeEscalation != nil {
+		sc.AllowPrivilegeEscalation = spec.AllowPrivilegeEscalation
+		fields = append(fields, "securityContext.allowPrivilegeEscalation")
+	}
+
+	if spec.RunAsNonRoot != nil {
+		sc.RunAsNonRoot = spec.RunAsNonRoot
+		fields = append(fields, "securityContext.runAsNonRoot")
+	}
+
+	if spec.ReadOnlyRootFilesystem != nil {
+		sc.ReadOnlyRootFilesystem = spec.ReadOnlyRootFilesystem
+		fields = append(fields, "securityContext.readOnlyRootFilesystem")
+	}
+
+	if spec.Privileged != nil {
+		sc.Privileged = spec.Privileged
+		fields = append(fields, "securityContext.privileged")
+	}
+
+	if spec.Capabilities != nil {
+		if sc.Capabilities == nil {
+			sc.Capabilities = &kcore.Capabilities{}
+		}
+		if len(spec.Capabilities.Add) > 0 {
+			for _, capability := range spec.Capabilities.Add {
+				if !hasCapability(sc.Capabilities.Add, capability) {
+					sc.Capabilities.Add = append(sc.Capabilities.Add, capability)
+				}
+			}
+			fields = append(fields, "securityContext.capabilities.add")
+		}
+		if len(spec.Capabilities.RemoveDrop) > 0 {
+			var drop []kcore.Capability
+			for _, capability := range sc.Capabilities.Drop {
+				if !hasCapability(spec.Capabilities.RemoveDrop, capability) {
+					drop = append(drop, capability)
+				}
+			}
+			sc.Capabilities.Drop = drop
+			fields = append(fields, "securityContext.capabilities.drop")
+		}
+	}
+
+	if spec.RunAsUser != nil {
+		sc.RunAsUser = spec.RunAsUser
+		fields = append(fields, "securityContext.runAsUser")
+	}
+
+	if spec.SeccompProfile != nil {
+		sc.SeccompProfile = &kcore.SeccompProfile{Type: *spec.SeccompProfile}
+		fields = append(fields, "securityContext.seccompProfile")
+	}
+
+	if spec.ProcMount != nil {
+		sc.ProcMount = spec.ProcMount
+		fields = append(fields, "securityContext.procMount")
+	}
+
+	return fields
+}
+
+// setAppArmorProfile sets the AppArmor profile of a container through the pod template annotation
+func setAppArmorProfile(template *kcore.PodTemplateSpec, container string, spec *apiv1alpha1.ConfigurationSpec) []string {
+	if spec.AppArmorProfile == nil {
+		return nil
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[appArmorAnnotationPrefix+container] = *spec.AppArmorProfile
+	return []string{"metadata.annotations." + appArmorAnnotationPrefix + container}
+}
+
+// imageWithTag replaces the tag of an image reference, keeping the registry port and dropping any digest
+func imageWithTag(image, tag string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image + ":" + tag
+}
+
+func hasCapability(capabilities []kcore.Capability, capability kcore.Capability) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	kcore "k8s.io/api/core/v1"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+func TestSelectContainers(t *testing.T) {
+	containers := []kcore.Container{{Name: "app"}, {Name: "app-sidecar"}, {Name: "proxy"}}
+
+	tests := []struct {
+		name     string
+		selector *apiv1alpha1.ContainerSelector
+		want     []int
+	}{
+		{"no selector targets the first container", nil, []int{0}},
+		{"empty names target the first container", &apiv1alpha1.ContainerSelector{}, []int{0}},
+		{"exact name", &apiv1alpha1.ContainerSelector{Names: []string{"proxy"}}, []int{2}},
+		{"glob pattern", &apiv1alpha1.ContainerSelector{Names: []string{"app*"}}, []int{0, 1}},
+		{"all", &apiv1alpha1.ContainerSelector{Names: []string{"all"}}, []int{0, 1, 2}},
+		{"wildcard", &apiv1alpha1.ContainerSelector{Names: []string{"*"}}, []int{0, 1, 2}},
+		{"several names match once", &apiv1alpha1.ContainerSelector{Names: []string{"app", "app*"}}, []int{0, 1}},
+		{"invalid pattern is compared literally", &apiv1alpha1.ContainerSelector{Names: []string{"[app"}}, nil},
+		{"no match", &apiv1alpha1.ContainerSelector{Names: []string{"db"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectContainers(containers, tt.selector); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectContainers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := selectContainers(nil, nil); got != nil {
+		t.Errorf("selectContainers() without containers = %v, want none", got)
+	}
+}
+
+func TestImageWithTag(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"nginx", "nginx:broken"},
+		{"nginx:1.25", "nginx:broken"},
+		{"library/nginx:1.25", "library/nginx:broken"},
+		{"registry.example.com:5000/team/app", "registry.example.com:5000/team/app:broken"},
+		{"registry.example.com:5000/team/app:v1", "registry.example.com:5000/team/app:broken"},
+		{"nginx@sha256:0123456789abcdef", "nginx:broken"},
+		{"nginx:1.25@sha256:0123456789abcdef", "nginx:broken"},
+		{"localhost:5000/app:v1@sha256:0123456789abcdef", "localhost:5000/app:broken"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := imageWithTag(tt.image, "broken"); got != tt.want {
+				t.Errorf("imageWithTag(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,467 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gomodules.xyz/jsonpatch/v2"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+	pkgpatch "github.com/AnaisUrlichs/security-controller/pkg/patch"
+)
+
+const (
+	// originalObjectAnnotationName holds the patched resource from before the first injection
+	originalObjectAnnotationName = "anaisurl.com/original-object"
+	// patchedPathsAnnotationName holds the JSON pointers of the fields changed by the patch
+	patchedPathsAnnotationName = "anaisurl.com/patched-paths"
+)
+
+// patchGVK returns the kind of the resources patched by the Configuration. Only namespaced kinds can be patched.
+func (r *ConfigurationReconciler) patchGVK(patch *apiv1alpha1.PatchConfiguration) (schema.GroupVersionKind, error) {
+	gv, err := schema.ParseGroupVersion(patch.APIVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, err
+	}
+	gvk := gv.WithKind(patch.Kind)
+	mapping, err := r.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return gvk, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return gvk, fmt.Errorf("%s is not namespaced, only namespaced kinds can be patched", gvk.Kind)
+	}
+	return gvk, nil
+}
+
+// listPatchTargets returns the resources of the patched kind matching the list options
+func (r *ConfigurationReconciler) listPatchTargets(ctx context.Context, patch *apiv1alpha1.PatchConfiguration, opts ...client.ListOption) ([]client.Object, error) {
+	gvk, err := r.patchGVK(patch)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.watchPatchKind(gvk); err != nil {
+		return nil, err
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err := r.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+	objects := make([]client.Object, 0, len(list.Items))
+	for i := range list.Items {
+		objects = append(objects, &list.Items[i])
+	}
+	return objects, nil
+}
+
+// watchPatchKind watches the resources of a patched kind, so their changes trigger the
+// reconciliation like the changes of workloads. Kinds are only known once a Configuration patches them.
+func (r *ConfigurationReconciler) watchPatchKind(gvk schema.GroupVersionKind) error {
+	r.watchedKindsMu.Lock()
+	defer r.watchedKindsMu.Unlock()
+	if r.controller == nil || r.watchedKinds[gvk] {
+		return nil
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := r.controller.Watch(&source.Kind{Type: obj},
+		handler.EnqueueRequestsFromMapFunc(r.configurationsForWorkload), annotatedWorkload); err != nil {
+		return err
+	}
+	if r.watchedKinds == nil {
+		r.watchedKinds = map[schema.GroupVersionKind]bool{}
+	}
+	r.watchedKinds[gvk] = true
+	return nil
+}
+
+// targetsKind reports whether the Configuration targets the kind of the object. Configurations
+// with a patch only target the patched kind, the others only target workloads.
+func targetsKind(mdConf *apiv1alpha1.Configuration, obj client.Object) bool {
+	u, patched := obj.(*unstructured.Unstructured)
+	if mdConf.Spec.Patch == nil {
+		return !patched
+	}
+	return patched && u.GetAPIVersion() == mdConf.Spec.Patch.APIVersion && u.GetKind() == mdConf.Spec.Patch.Kind
+}
+
+// patchDocument returns the patch of the Configuration
+func patchDocument(patch *apiv1alpha1.PatchConfiguration) (client.Patch, error) {
+	patchType, data, err := pkgpatch.Parse(string(patch.Type), patch.Patch)
+	if err != nil {
+		return nil, err
+	}
+	return client.RawPatch(patchType, data), nil
+}
+
+// objectContent returns the resource without the fields that are not patched
+func objectContent(obj *unstructured.Unstructured) ([]byte, error) {
+	content := runtime.DeepCopyJSON(obj.Object)
+	for _, field := range []string{"apiVersion", "kind", "metadata", "status"} {
+		delete(content, field)
+	}
+	return json.Marshal(content)
+}
+
+// patchedFields returns the paths of the fields changed by the patch and the JSON patch of the changes
+func patchedFields(original, patched *unstructured.Unstructured) ([]string, string, error) {
+	originalContent, err := objectContent(original)
+	if err != nil {
+		return nil, "", err
+	}
+	patchedContent, err := objectContent(patched)
+	if err != nil {
+		return nil, "", err
+	}
+	operations, err := jsonpatch.CreatePatch(originalContent, patchedContent)
+	if err != nil {
+		return nil, "", err
+	}
+	diff, err := json.Marshal(operations)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var fields []string
+	for _, operation := range operations {
+		fields = append(fields, operation.Path)
+	}
+	return fields, string(diff), nil
+}
+
+// injectPatch applies the patch of the Configuration to a resource and returns the affected resource.
+// The original resource is recorded before it is patched, so a failed patch can still be reverted.
+// Resources already patched by the Configuration are not patched again, as JSON patches that add
+// to lists are not idempotent.
+func (r *ConfigurationReconciler) injectPatch(ctx context.Context, mdConf *apiv1alpha1.Configuration, obj *unstructured.Unstructured) (*apiv1alpha1.AffectedWorkload, error) {
+	patch, err := patchDocument(mdConf.Spec.Patch)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, hadSnapshot := obj.GetAnnotations()[originalObjectAnnotationName]
+	if hadSnapshot && obj.GetAnnotations()[injectedByAnnotationName] == configurationKey(mdConf) {
+		return patchedResource(obj, snapshot)
+	}
+	if !hadSnapshot {
+		content, err := objectContent(obj)
+		if err != nil {
+			return nil, err
+		}
+		snapshot = string(content)
+	}
+	injectionTime := firstInjectionTime(obj, metav1.Now())
+	if err := r.mergeAnnotations(ctx, obj, map[string]interface{}{
+		injectedByAnnotationName:     configurationKey(mdConf),
+		injectionTimeAnnotationName:  injectionTime.Format(time.RFC3339),
+		originalObjectAnnotationName: snapshot,
+	}); err != nil {
+		return nil, err
+	}
+
+	original := obj.DeepCopy()
+	if err := r.Patch(ctx, obj, patch, client.FieldOwner(fieldManager)); err != nil {
+		// The resource was not patched, so it must not be counted or reverted as injected
+		if hadSnapshot {
+			return nil, err
+		}
+		if cleanupErr := r.mergeAnnotations(ctx, obj, map[string]interface{}{
+			injectedByAnnotationName:     nil,
+			injectionTimeAnnotationName:  nil,
+			originalObjectAnnotationName: nil,
+		}); cleanupErr != nil {
+			return nil, kerrors.NewAggregate([]error{err, cleanupErr})
+		}
+		return nil, err
+	}
+	fields, _, err := patchedFields(original, obj)
+	if err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).Info("Patched resource", "resource", objectKey(obj), "fields", fields)
+	paths, err := json.Marshal(revertPaths(fields, original.Object, obj.Object))
+	if err != nil {
+		return nil, err
+	}
+
+	now := metav1.Now()
+	if err := r.mergeAnnotations(ctx, obj, map[string]interface{}{
+		annotationName:             "false",
+		lastUpdatedAnnotationName:  now.Format(time.RFC3339),
+		patchedPathsAnnotationName: string(paths),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &apiv1alpha1.AffectedWorkload{
+		Kind:          obj.GetKind(),
+		Namespace:     obj.GetNamespace(),
+		Name:          obj.GetName(),
+		Fields:        fields,
+		InjectionTime: injectionTime,
+	}, nil
+}
+
+// patchedResource returns the affected resource of a resource that is already patched, with the
+// fields that differ from its snapshot
+func patchedResource(obj *unstructured.Unstructured, snapshot string) (*apiv1alpha1.AffectedWorkload, error) {
+	original := &unstructured.Unstructured{}
+	if err := json.Unmarshal([]byte(snapshot), &original.Object); err != nil {
+		return nil, fmt.Errorf("invalid resource snapshot: %w", err)
+	}
+	fields, _, err := patchedFields(original, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1alpha1.AffectedWorkload{
+		Kind:          obj.GetKind(),
+		Namespace:     obj.GetNamespace(),
+		Name:          obj.GetName(),
+		Fields:        fields,
+		InjectionTime: firstInjectionTime(obj, metav1.Now()),
+	}, nil
+}
+
+// dryRunPatch computes the changes of the patch to a resource with a server-side dry run
+func (r *ConfigurationReconciler) dryRunPatch(ctx context.Context, mdConf *apiv1alpha1.Configuration, obj *unstructured.Unstructured) (*apiv1alpha1.DryRunResult, error) {
+	patch, err := patchDocument(mdConf.Spec.Patch)
+	if err != nil {
+		return nil, err
+	}
+	patched := obj.DeepCopy()
+	if err := r.Patch(ctx, patched, patch, client.DryRunAll, client.FieldOwner(fieldManager)); err != nil {
+		return nil, err
+	}
+	fields, diff, err := patchedFields(obj, patched)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1alpha1.DryRunResult{
+		WorkloadReference: workloadReference(obj),
+		Fields:            fields,
+		Diff:              diff,
+	}, nil
+}
+
+// revertPatch restores the fields changed by the patch from the snapshot annotation, so changes of other
+// fields made since the injection are kept. Resources without a snapshot were not patched.
+func (r *ConfigurationReconciler) revertPatch(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	annotations := obj.GetAnnotations()
+	snapshot, ok := annotations[originalObjectAnnotationName]
+	if !ok {
+		return false, nil
+	}
+	original := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(snapshot), &original); err != nil {
+		return false, fmt.Errorf("invalid resource snapshot: %w", err)
+	}
+
+	var paths []string
+	if value, ok := annotations[patchedPathsAnnotationName]; ok {
+		if err := json.Unmarshal([]byte(value), &paths); err != nil {
+			return false, fmt.Errorf("invalid patched paths: %w", err)
+		}
+	} else {
+		// Resources patched before the paths were recorded revert every field that differs from the snapshot
+		fields, _, err := patchedFields(&unstructured.Unstructured{Object: original}, obj)
+		if err != nil {
+			return false, err
+		}
+		paths = revertPaths(fields, original, obj.Object)
+	}
+
+	log.FromContext(ctx).Info("Reverting resource", "kind", obj.GetKind(), "name", obj.GetName(), "namespace", obj.GetNamespace())
+	if operations := revertOperations(paths, original, obj.Object); len(operations) > 0 {
+		data, err := json.Marshal(operations)
+		if err != nil {
+			return false, err
+		}
+		if err := r.Patch(ctx, obj, client.RawPatch(types.JSONPatchType, data), client.FieldOwner(revertFieldManager)); err != nil {
+			return false, err
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				originalObjectAnnotationName: nil,
+				patchedPathsAnnotationName:   nil,
+				injectedByAnnotationName:     nil,
+				injectionTimeAnnotationName:  nil,
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := r.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data), client.FieldOwner(revertFieldManager)); err != nil {
+		return false, err
+	}
+	if err := r.releaseOwnership(ctx, obj); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// revertPaths returns the JSON pointers of the fields to restore on revert from the paths changed by the
+// patch. Changes of list elements restore the whole list, as their indices shift when elements are
+// added or removed. Paths within another path are left out.
+func revertPaths(fields []string, original, patched map[string]interface{}) []string {
+	var paths []string
+	for _, field := range fields {
+		segments := pointerSegments(field)
+		for i := 1; i < len(segments); i++ {
+			_, originalList := valueAt(original, segments[:i]).([]interface{})
+			_, patchedList := valueAt(patched, segments[:i]).([]interface{})
+			if originalList || patchedList {
+				segments = segments[:i]
+				break
+			}
+		}
+		paths = append(paths, pointer(segments))
+	}
+	sort.Strings(paths)
+
+	var reverted []string
+	for _, path := range paths {
+		if withinPaths(path, reverted) {
+			continue
+		}
+		reverted = append(reverted, path)
+	}
+	return reverted
+}
+
+// revertOperations returns the JSON patch restoring the paths of the current resource from the
+// original one. Paths whose parent was removed since the injection are restored from their
+// closest existing parent.
+func revertOperations(paths []string, original, current map[string]interface{}) []map[string]interface{} {
+	var operations []map[string]interface{}
+	var restored []string
+	for _, path := range paths {
+		segments := pointerSegments(path)
+		if len(segments) == 0 {
+			continue
+		}
+		if _, ok := lookup(original, segments); !ok {
+			if _, ok := lookup(current, segments); ok {
+				operations = append(operations, map[string]interface{}{"op": "remove", "path": path})
+			}
+			continue
+		}
+
+		depth := len(segments)
+		for i := 1; i < len(segments); i++ {
+			if _, ok := lookup(current, segments[:i]); !ok {
+				depth = i
+				break
+			}
+		}
+		restore := pointer(segments[:depth])
+		if withinPaths(restore, restored) {
+			continue
+		}
+		value, _ := lookup(original, segments[:depth])
+		operations = append(operations, map[string]interface{}{"op": "add", "path": restore, "value": value})
+		restored = append(restored, restore)
+	}
+	return operations
+}
+
+// withinPaths reports whether the JSON pointer is one of the parent paths or within one of them
+func withinPaths(path string, parents []string) bool {
+	for _, parent := range parents {
+		if path == parent || strings.HasPrefix(path, parent+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the value of a JSON document at the path segments
+func lookup(document interface{}, segments []string) (interface{}, bool) {
+	value := document
+	for _, segment := range segments {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[segment]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// valueAt returns the value of a JSON document at the path segments, or nil if there is none
+func valueAt(document interface{}, segments []string) interface{} {
+	value, _ := lookup(document, segments)
+	return value
+}
+
+// pointerSegments returns the unescaped segments of a JSON pointer
+func pointerSegments(path string) []string {
+	if path == "" || path == "/" {
+		return nil
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+	}
+	return segments
+}
+
+// pointer returns the JSON pointer of the path segments
+func pointer(segments []string) string {
+	var path strings.Builder
+	for _, segment := range segments {
+		path.WriteString("/")
+		path.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(segment))
+	}
+	return path.String()
+}
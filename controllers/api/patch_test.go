@@ -0,0 +1,88 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRevertPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   []string
+		original string
+		patched  string
+		want     []string
+	}{
+		{"changed field", []string{"/spec/host"}, `{"spec":{"host":"a"}}`, `{"spec":{"host":"b"}}`, []string{"/spec/host"}},
+		{"list element restores the list", []string{"/spec/rules/1/host"}, `{"spec":{"rules":[{"host":"a"},{"host":"b"}]}}`, `{"spec":{"rules":[{"host":"a"},{"host":"c"}]}}`, []string{"/spec/rules"}},
+		{"added list element", []string{"/spec/tls/0"}, `{"spec":{"tls":[]}}`, `{"spec":{"tls":[{"hosts":["a"]}]}}`, []string{"/spec/tls"}},
+		{"removed list element", []string{"/spec/tls/1"}, `{"spec":{"tls":[{},{}]}}`, `{"spec":{"tls":[{}]}}`, []string{"/spec/tls"}},
+		{"paths within another path", []string{"/spec/rules/0/host", "/spec/rules/1", "/spec/rules"}, `{"spec":{"rules":[{"host":"a"}]}}`, `{"spec":{"rules":[{"host":"b"},{}]}}`, []string{"/spec/rules"}},
+		{"escaped key", []string{"/spec/a~1b"}, `{"spec":{"a/b":1}}`, `{"spec":{"a/b":2}}`, []string{"/spec/a~1b"}},
+		{"sibling with a common prefix", []string{"/spec/ab", "/spec/a"}, `{"spec":{"a":1,"ab":1}}`, `{"spec":{"a":2,"ab":2}}`, []string{"/spec/a", "/spec/ab"}},
+		{"path within a path sorted before a sibling", []string{"/spec/a/x", "/spec/a-b", "/spec/a"}, `{"spec":{"a":{"x":1},"a-b":1}}`, `{"spec":{"a":{"x":2},"a-b":2}}`, []string{"/spec/a", "/spec/a-b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := fromJSON(t, tt.original).(map[string]interface{})
+			patched := fromJSON(t, tt.patched).(map[string]interface{})
+			if got := revertPaths(tt.fields, original, patched); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("revertPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevertOperations(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    []string
+		original string
+		current  string
+		want     string
+	}{
+		{"changed field", []string{"/spec/host"}, `{"spec":{"host":"a"}}`, `{"spec":{"host":"b","port":80}}`, `[{"op":"add","path":"/spec/host","value":"a"}]`},
+		{"added field", []string{"/spec/host"}, `{"spec":{}}`, `{"spec":{"host":"b"}}`, `[{"op":"remove","path":"/spec/host"}]`},
+		{"field removed since", []string{"/spec/host"}, `{"spec":{}}`, `{"spec":{}}`, `null`},
+		{"parent removed since", []string{"/spec/tls/hosts"}, `{"spec":{"tls":{"hosts":["a"],"secret":"s"}}}`, `{"spec":{}}`, `[{"op":"add","path":"/spec/tls","value":{"hosts":["a"],"secret":"s"}}]`},
+		{"restored parent covers its children", []string{"/spec/tls/hosts", "/spec/tls/secret"}, `{"spec":{"tls":{"hosts":["a"],"secret":"s"}}}`, `{"spec":{}}`, `[{"op":"add","path":"/spec/tls","value":{"hosts":["a"],"secret":"s"}}]`},
+		{"list", []string{"/spec/rules"}, `{"spec":{"rules":[{"host":"a"}]}}`, `{"spec":{"rules":[{"host":"a"},{"host":"b"}]}}`, `[{"op":"add","path":"/spec/rules","value":[{"host":"a"}]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := fromJSON(t, tt.original).(map[string]interface{})
+			current := fromJSON(t, tt.current).(map[string]interface{})
+			got := revertOperations(tt.paths, original, current)
+			if !jsonEqual(got, fromJSON(t, tt.want)) {
+				t.Errorf("revertOperations() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPointer(t *testing.T) {
+	for _, path := range []string{"/spec", "/spec/rules/0/host", "/metadata/annotations/anaisurl.com~1misconfiguration", "/a~0b"} {
+		if got := pointer(pointerSegments(path)); got != path {
+			t.Errorf("pointer(pointerSegments(%q)) = %q", path, got)
+		}
+	}
+	if got := pointerSegments("/a~1b/c~0d"); !reflect.DeepEqual(got, []string{"a/b", "c~d"}) {
+		t.Errorf("pointerSegments() = %v", got)
+	}
+}
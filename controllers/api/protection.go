@@ -0,0 +1,52 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+
+	kcore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// protectedAnnotationName opts a namespace or workload out of every experiment when set to "true"
+const protectedAnnotationName = "anaisurl.com/chaos-protected"
+
+// protection returns why the workload must not be misconfigured. An empty reason means the
+// workload is not protected.
+func (r *ConfigurationReconciler) protection(ctx context.Context, obj client.Object) (string, string, error) {
+	for _, namespace := range r.ProtectedNamespaces {
+		if obj.GetNamespace() == namespace {
+			return "ProtectedNamespace", fmt.Sprintf("Namespace %s is protected by the controller", namespace), nil
+		}
+	}
+
+	if obj.GetAnnotations()[protectedAnnotationName] == "true" {
+		return "ProtectedWorkload", fmt.Sprintf("Workload is annotated with %s", protectedAnnotationName), nil
+	}
+
+	namespace := &kcore.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: obj.GetNamespace()}, namespace); err != nil {
+		return "", "", err
+	}
+	if namespace.Annotations[protectedAnnotationName] == "true" {
+		return "ProtectedNamespace", fmt.Sprintf("Namespace %s is annotated with %s", namespace.Name, protectedAnnotationName), nil
+	}
+	return "", "", nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+
+	kapps "k8s.io/api/apps/v1"
+	kcore "k8s.io/api/core/v1"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+// deploymentCondition returns the condition of the deployment with the given type
+func deploymentCondition(status *kapps.DeploymentStatus, conditionType kapps.DeploymentConditionType) *kapps.DeploymentCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// deploymentNotReady returns why the deployment does not pass the readiness gate. An empty
+// reason means the deployment is ready to be misconfigured.
+func deploymentNotReady(gate *apiv1alpha1.ReadinessGate, cm *kapps.Deployment) (string, string) {
+	requireAvailable, requireRolloutComplete := readinessRequirements(gate)
+
+	if requireAvailable {
+		available := deploymentCondition(&cm.Status, kapps.DeploymentAvailable)
+		if available == nil {
+			return "NotAvailable", "Deployment has no Available condition yet"
+		}
+		if available.Status != kcore.ConditionTrue {
+			return "NotAvailable", fmt.Sprintf("Deployment is not available: %s", available.Message)
+		}
+	}
+
+	if requireRolloutComplete {
+		if progressing := deploymentCondition(&cm.Status, kapps.DeploymentProgressing); progressing != nil && progressing.Reason == "ProgressDeadlineExceeded" {
+			return "RolloutFailed", fmt.Sprintf("Deployment exceeded its progress deadline: %s", progressing.Message)
+		}
+		if cm.Status.ObservedGeneration < cm.Generation {
+			return "RolloutInProgress", "Latest generation of the deployment is not observed yet"
+		}
+		replicas := int32(1)
+		if cm.Spec.Replicas != nil {
+			replicas = *cm.Spec.Replicas
+		}
+		if cm.Status.UpdatedReplicas < replicas {
+			return "RolloutInProgress", fmt.Sprintf("%d of %d replicas updated", cm.Status.UpdatedReplicas, replicas)
+		}
+		if cm.Status.Replicas > cm.Status.UpdatedReplicas {
+			return "RolloutInProgress", fmt.Sprintf("%d old replicas pending termination", cm.Status.Replicas-cm.Status.UpdatedReplicas)
+		}
+		if cm.Status.AvailableReplicas < cm.Status.UpdatedReplicas {
+			return "RolloutInProgress", fmt.Sprintf("%d of %d updated replicas available", cm.Status.AvailableReplicas, cm.Status.UpdatedReplicas)
+		}
+	}
+	return "", ""
+}
+
+// statefulSetNotReady returns why the StatefulSet does not pass the readiness gate
+func statefulSetNotReady(gate *apiv1alpha1.ReadinessGate, set *kapps.StatefulSet) (string, string) {
+	requireAvailable, requireRolloutComplete := readinessRequirements(gate)
+	replicas := int32(1)
+	if set.Spec.Replicas != nil {
+		replicas = *set.Spec.Replicas
+	}
+
+	if requireAvailable && set.Status.AvailableReplicas < replicas {
+		return "NotAvailable", fmt.Sprintf("%d of %d replicas available", set.Status.AvailableReplicas, replicas)
+	}
+	if requireRolloutComplete {
+		if set.Status.ObservedGeneration < set.Generation {
+			return "RolloutInProgress", "Latest generation of the StatefulSet is not observed yet"
+		}
+		if set.Status.UpdatedReplicas < replicas || set.Status.CurrentRevision != set.Status.UpdateRevision {
+			return "RolloutInProgress", fmt.Sprintf("%d of %d replicas updated", set.Status.UpdatedReplicas, replicas)
+		}
+	}
+	return "", ""
+}
+
+// daemonSetNotReady returns why the DaemonSet does not pass the readiness gate
+func daemonSetNotReady(gate *apiv1alpha1.ReadinessGate, set *kapps.DaemonSet) (string, string) {
+	requireAvailable, requireRolloutComplete := readinessRequirements(gate)
+	desired := set.Status.DesiredNumberScheduled
+
+	if requireAvailable && set.Status.NumberAvailable < desired {
+		return "NotAvailable", fmt.Sprintf("%d of %d scheduled pods available", set.Status.NumberAvailable, desired)
+	}
+	if requireRolloutComplete {
+		if set.Status.ObservedGeneration < set.Generation {
+			return "RolloutInProgress", "Latest generation of the DaemonSet is not observed yet"
+		}
+		if set.Status.UpdatedNumberScheduled < desired {
+			return "RolloutInProgress", fmt.Sprintf("%d of %d scheduled pods updated", set.Status.UpdatedNumberScheduled, desired)
+		}
+	}
+	return "", ""
+}
+
+// replicaSetNotReady returns why the ReplicaSet does not pass the readiness gate. ReplicaSets do
+// not roll out template changes, so only the observed generation is checked for the rollout.
+func replicaSetNotReady(gate *apiv1alpha1.ReadinessGate, set *kapps.ReplicaSet) (string, string) {
+	requireAvailable, requireRolloutComplete := readinessRequirements(gate)
+	replicas := int32(1)
+	if set.Spec.Replicas != nil {
+		replicas = *set.Spec.Replicas
+	}
+
+	if requireAvailable && set.Status.AvailableReplicas < replicas {
+		return "NotAvailable", fmt.Sprintf("%d of %d replicas available", set.Status.AvailableReplicas, replicas)
+	}
+	if requireRolloutComplete && set.Status.ObservedGeneration < set.Generation {
+		return "RolloutInProgress", "Latest generation of the ReplicaSet is not observed yet"
+	}
+	return "", ""
+}
+
+// readinessRequirements returns whether the gate requires the workload to be available and rolled out
+func readinessRequirements(gate *apiv1alpha1.ReadinessGate) (bool, bool) {
+	requireAvailable, requireRolloutComplete := true, true
+	if gate != nil {
+		if gate.RequireAvailable != nil {
+			requireAvailable = *gate.RequireAvailable
+		}
+		if gate.RequireRolloutComplete != nil {
+			requireRolloutComplete = *gate.RequireRolloutComplete
+		}
+	}
+	return requireAvailable, requireRolloutComplete
+}
@@ -0,0 +1,355 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	kcore "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+// originalPodTemplate returns the pod template from before the first injection together with its
+// snapshot. Templates without a snapshot annotation have not been misconfigured yet.
+func originalPodTemplate(annotations map[string]string, template *kcore.PodTemplateSpec) (*kcore.PodTemplateSpec, string, error) {
+	if snapshot, ok := annotations[snapshotAnnotationName]; ok {
+		original := &kcore.PodTemplateSpec{}
+		if err := json.Unmarshal([]byte(snapshot), original); err != nil {
+			return nil, "", fmt.Errorf("invalid pod template snapshot: %w", err)
+		}
+		return original, snapshot, nil
+	}
+	snapshot, err := json.Marshal(template)
+	if err != nil {
+		return nil, "", err
+	}
+	return template.DeepCopy(), string(snapshot), nil
+}
+
+// restorePodTemplate restores the pod template from the snapshot annotation and
+// reports whether a snapshot was found
+func restorePodTemplate(annotations map[string]string, template *kcore.PodTemplateSpec) (bool, error) {
+	snapshot, ok := annotations[snapshotAnnotationName]
+	if !ok {
+		return false, nil
+	}
+	original := kcore.PodTemplateSpec{}
+	if err := json.Unmarshal([]byte(snapshot), &original); err != nil {
+		return false, fmt.Errorf("invalid pod template snapshot: %w", err)
+	}
+	*template = original
+
+	delete(annotations, snapshotAnnotationName)
+	delete(annotations, injectedByAnnotationName)
+	delete(annotations, injectionTimeAnnotationName)
+	delete(annotations, resultsAnnotationName)
+	return true, nil
+}
+
+// revertWorkload restores the original pod template of a workload or the original patched resource. The fields applied by the
+// field manager of the controller are set back to their snapshot values by the revert field manager
+// and released afterwards, so fields that were added by the injection are removed. Workloads
+// that were not misconfigured through server-side apply are updated from the snapshot instead.
+func (r *ConfigurationReconciler) revertWorkload(ctx context.Context, obj client.Object) (bool, error) {
+	if u, patched := obj.(*unstructured.Unstructured); patched {
+		return r.revertPatch(ctx, u)
+	}
+	applied, err := appliedFields(obj, fieldManager)
+	if err != nil {
+		return false, err
+	}
+	if applied == nil {
+		return r.revertWorkloadUpdate(ctx, obj)
+	}
+
+	kind := kindOf(obj)
+	original, _, err := originalPodTemplate(obj.GetAnnotations(), kind.podTemplate(obj))
+	if err != nil {
+		return false, err
+	}
+	originalObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(original)
+	if err != nil {
+		return false, err
+	}
+	spec := ownedValues(applied, map[string]interface{}{
+		"spec": kind.nestedTemplate(originalObj),
+	})["spec"]
+	specValues, _ := spec.(map[string]interface{})
+
+	// the opt-in annotations were taken over on injection and are kept
+	annotations := map[string]string{}
+	for _, name := range []string{annotationName, lastUpdatedAnnotationName} {
+		if value, ok := obj.GetAnnotations()[name]; ok {
+			annotations[name] = value
+		}
+	}
+
+	replaced, err := injectedPorts(obj.GetAnnotations(), &original.Spec)
+	if err != nil {
+		return false, err
+	}
+
+	log.FromContext(ctx).Info("Reverting workload", "kind", kind.gvk.Kind, "name", obj.GetName(), "namespace", obj.GetNamespace())
+	if err := r.apply(ctx, applyIntent(kind.gvk, obj, annotations, specValues), revertFieldManager); err != nil {
+		return false, err
+	}
+	if err := r.replacePorts(ctx, obj, replaced, revertFieldManager); err != nil {
+		return false, err
+	}
+	released := applyIntent(kind.gvk, obj, nil, nil)
+	if err := r.apply(ctx, released, fieldManager); err != nil {
+		return false, err
+	}
+	if err := r.releaseOwnership(ctx, released); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// hasSnapshot reports whether the workload or patched resource carries the snapshot of an injection
+func hasSnapshot(obj client.Object) bool {
+	name := snapshotAnnotationName
+	if _, patched := obj.(*unstructured.Unstructured); patched {
+		name = originalObjectAnnotationName
+	}
+	_, ok := obj.GetAnnotations()[name]
+	return ok
+}
+
+// injectedPorts returns the original ports of the containers whose ports were replaced by the
+// injection, as recorded in the results annotation
+func injectedPorts(annotations map[string]string, original *kcore.PodSpec) ([]containerPorts, error) {
+	value, ok := annotations[resultsAnnotationName]
+	if !ok {
+		return nil, nil
+	}
+	results := misconfigurationResults{}
+	if err := json.Unmarshal([]byte(value), &results); err != nil {
+		return nil, fmt.Errorf("invalid misconfiguration results: %w", err)
+	}
+
+	var replaced []containerPorts
+	for _, result := range results.Containers {
+		portChanged := false
+		for _, field := range result.Fields {
+			portChanged = portChanged || field == containerPortField
+		}
+		if !portChanged {
+			continue
+		}
+		list, containers := "containers", original.Containers
+		if result.InitContainer {
+			list, containers = "initContainers", original.InitContainers
+		}
+		for _, c := range containers {
+			if c.Name == result.Name {
+				replaced = append(replaced, containerPorts{list: list, name: c.Name, ports: c.Ports})
+			}
+		}
+	}
+	return replaced, nil
+}
+
+// revertWorkloadUpdate restores the pod template of a workload from the snapshot with an update.
+// Workloads without a snapshot were not misconfigured and are left untouched.
+func (r *ConfigurationReconciler) revertWorkloadUpdate(ctx context.Context, obj client.Object) (bool, error) {
+	kind := kindOf(obj)
+	template := kind.podTemplate(obj)
+	restored, err := restorePodTemplate(obj.GetAnnotations(), template)
+	if err != nil || !restored {
+		return false, err
+	}
+
+	log.FromContext(ctx).Info("Reverting workload", "kind", kind.gvk.Kind, "name", obj.GetName(), "namespace", obj.GetNamespace())
+	if err := r.Client.Update(ctx, obj); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// listInjectedWorkloads returns the workloads and patched resources the Configuration is currently injected into
+func (r *ConfigurationReconciler) listInjectedWorkloads(ctx context.Context, mdConf *apiv1alpha1.Configuration) ([]client.Object, error) {
+	workloads, err := r.listPodTemplateWorkloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mdConf.Spec.Patch != nil {
+		patched, err := r.listPatchTargets(ctx, mdConf.Spec.Patch)
+		if err != nil {
+			return nil, err
+		}
+		workloads = append(workloads, patched...)
+	}
+
+	var injected []client.Object
+	for _, obj := range workloads {
+		if obj.GetAnnotations()[injectedByAnnotationName] == configurationKey(mdConf) {
+			injected = append(injected, obj)
+		}
+	}
+	return injected, nil
+}
+
+// revert restores the original pod template of every workload the Configuration was injected into
+func (r *ConfigurationReconciler) revert(ctx context.Context, mdConf *apiv1alpha1.Configuration) error {
+	return r.updateStatus(ctx, mdConf, r.revertInjections(ctx, mdConf))
+}
+
+// revertInjections restores the original pod template of every workload the Configuration was
+// injected into and sets the Reverted condition
+func (r *ConfigurationReconciler) revertInjections(ctx context.Context, mdConf *apiv1alpha1.Configuration) error {
+	workloads, err := r.listInjectedWorkloads(ctx, mdConf)
+	if err != nil {
+		return err
+	}
+
+	var revertErrors []error
+	reverted := 0
+	for _, obj := range workloads {
+		if _, err := r.revertWorkload(ctx, obj); err != nil {
+			revertErrors = append(revertErrors, fmt.Errorf("failed to revert %s: %w", objectKey(obj), err))
+			continue
+		}
+		removeAffectedWorkload(&mdConf.Status, kindName(obj), obj.GetNamespace(), obj.GetName())
+		reverted++
+	}
+	if reverted > 0 {
+		now := metav1.Now()
+		mdConf.Status.LastRevertTime = &now
+	}
+
+	revertErr := kerrors.NewAggregate(revertErrors)
+	if revertErr != nil {
+		setCondition(mdConf, apiv1alpha1.ConditionReverted, metav1.ConditionFalse, "RevertFailed", revertErr.Error())
+	} else {
+		setCondition(mdConf, apiv1alpha1.ConditionReverted, metav1.ConditionTrue, "Reverted",
+			fmt.Sprintf("Restored the original pod template of %d workload(s)", reverted))
+	}
+	return revertErr
+}
+
+// halt reverts every injection of the Configuration while the kill switch is engaged
+func (r *ConfigurationReconciler) halt(ctx context.Context, mdConf *apiv1alpha1.Configuration) error {
+	log.FromContext(ctx).Info("Kill switch engaged, reverting every workload", "configuration", configurationKey(mdConf))
+	setCondition(mdConf, apiv1alpha1.ConditionHalted, metav1.ConditionTrue, "KillSwitchEngaged",
+		"No workloads are misconfigured while the kill switch is engaged")
+	mdConf.Status.NextScheduledTime = nil
+	return r.updateStatus(ctx, mdConf, r.revertInjections(ctx, mdConf))
+}
+
+// finalize reverts every injection of the Configuration before it is deleted. The finalizer is
+// kept and the deletion blocked until every workload was reverted.
+func (r *ConfigurationReconciler) finalize(ctx context.Context, mdConf *apiv1alpha1.Configuration) error {
+	if !controllerutil.ContainsFinalizer(mdConf, configurationFinalizer) {
+		return nil
+	}
+
+	if err := r.revertInjections(ctx, mdConf); err != nil {
+		setCondition(mdConf, apiv1alpha1.ConditionReverted, metav1.ConditionFalse, "DeletionBlocked",
+			fmt.Sprintf("Deletion is blocked until every workload is reverted: %s", err))
+		return r.updateStatus(ctx, mdConf, err)
+	}
+
+	log.FromContext(ctx).Info("Reverted every workload, removing the finalizer", "configuration", configurationKey(mdConf))
+	controllerutil.RemoveFinalizer(mdConf, configurationFinalizer)
+	return r.Update(ctx, mdConf)
+}
+
+// expireInjections reverts the workloads whose injection is older than the duration of the Configuration.
+// Expired workloads are marked so they are not misconfigured again.
+func (r *ConfigurationReconciler) expireInjections(ctx context.Context, mdConf *apiv1alpha1.Configuration) error {
+	if mdConf.Spec.Duration == nil {
+		return nil
+	}
+	workloads, err := r.listInjectedWorkloads(ctx, mdConf)
+	if err != nil {
+		return err
+	}
+
+	var revertErrors []error
+	for _, obj := range workloads {
+		injectionTime, err := injectedSince(obj)
+		if err != nil || time.Since(injectionTime) < mdConf.Spec.Duration.Duration {
+			continue
+		}
+
+		log.FromContext(ctx).Info("Misconfiguration expired", "workload", objectKey(obj))
+		setAnnotation(obj, annotationName, annotationValueExpired)
+		if _, err := r.revertWorkload(ctx, obj); err != nil {
+			revertErrors = append(revertErrors, fmt.Errorf("failed to revert %s: %w", objectKey(obj), err))
+			continue
+		}
+		removeAffectedWorkload(&mdConf.Status, kindName(obj), obj.GetNamespace(), obj.GetName())
+
+		now := metav1.Now()
+		mdConf.Status.LastRevertTime = &now
+		setCondition(mdConf, apiv1alpha1.ConditionReverted, metav1.ConditionTrue, "DurationExpired",
+			fmt.Sprintf("Restored the original pod template of %s after %s", objectKey(obj), mdConf.Spec.Duration.Duration))
+	}
+	return kerrors.NewAggregate(revertErrors)
+}
+
+// firstInjectionTime returns the time the workload was first injected, or now if it is not injected yet
+func firstInjectionTime(obj client.Object, now metav1.Time) metav1.Time {
+	if injectionTime, err := time.Parse(time.RFC3339, obj.GetAnnotations()[injectionTimeAnnotationName]); err == nil {
+		return metav1.NewTime(injectionTime)
+	}
+	return now
+}
+
+// injectedSince returns the time the workload was first injected. Workloads injected before the
+// injection time was recorded fall back to the time of their last update.
+func injectedSince(obj client.Object) (time.Time, error) {
+	if value, ok := obj.GetAnnotations()[injectionTimeAnnotationName]; ok {
+		return time.Parse(time.RFC3339, value)
+	}
+	return time.Parse(time.RFC3339, obj.GetAnnotations()[lastUpdatedAnnotationName])
+}
+
+// nextExpiry returns the time until the next injection of the Configuration expires
+func nextExpiry(mdConf *apiv1alpha1.Configuration) time.Duration {
+	var next time.Duration
+	if mdConf.Spec.Duration == nil {
+		return next
+	}
+	for _, workload := range mdConf.Status.AffectedWorkloads {
+		remaining := time.Until(workload.InjectionTime.Add(mdConf.Spec.Duration.Duration))
+		if remaining <= 0 {
+			remaining = time.Second
+		}
+		if next == 0 || remaining < next {
+			next = remaining
+		}
+	}
+	return next
+}
+
+// configurationKey identifies a Configuration on the workloads it was injected into
+func configurationKey(mdConf *apiv1alpha1.Configuration) string {
+	return workloadKey(mdConf.Namespace, mdConf.Name)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kapps "k8s.io/api/apps/v1"
+	kcore "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+const (
+	// rolloutCheckInterval is how often the rollouts of misconfigured workloads are checked
+	rolloutCheckInterval = 15 * time.Second
+	// defaultMaxRestarts is the number of container restarts after which a rollout counts as failed
+	defaultMaxRestarts = 3
+	// annotationValueFailed marks workloads that were reverted because their rollout failed
+	annotationValueFailed = "failed"
+)
+
+// failedWaitingReasons are the reasons of waiting containers that cannot start without a change of the pod template
+var failedWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"CreateContainerConfigError": true,
+}
+
+// guardRollouts reverts the misconfigured workloads whose rollout failed and reports whether
+// a rollout is still in progress
+func (r *ConfigurationReconciler) guardRollouts(ctx context.Context, mdConf *apiv1alpha1.Configuration) (bool, error) {
+	guard := mdConf.Spec.RolloutGuard
+	if guard != nil && guard.Disabled {
+		return false, nil
+	}
+	maxRestarts := int32(defaultMaxRestarts)
+	if guard != nil && guard.MaxRestarts != nil {
+		maxRestarts = *guard.MaxRestarts
+	}
+
+	workloads, err := r.listInjectedWorkloads(ctx, mdConf)
+	if err != nil {
+		return false, err
+	}
+
+	var revertErrors []error
+	inProgress := false
+	for _, obj := range workloads {
+		// Rollouts are only known for the pod templates of workloads
+		if _, patched := obj.(*unstructured.Unstructured); patched {
+			continue
+		}
+		injectionTime, err := time.Parse(time.RFC3339, obj.GetAnnotations()[lastUpdatedAnnotationName])
+		if err != nil {
+			continue
+		}
+
+		reason, message, err := r.rolloutFailure(ctx, obj, injectionTime, maxRestarts)
+		if err != nil {
+			revertErrors = append(revertErrors, err)
+			continue
+		}
+		if reason == "" {
+			if notReady, _ := kindOf(obj).notReady(nil, obj); notReady != "" {
+				inProgress = true
+			}
+			continue
+		}
+
+		log.FromContext(ctx).Info("Rollout of the misconfiguration failed", "workload", objectKey(obj), "reason", reason)
+		setAnnotation(obj, annotationName, annotationValueFailed)
+		if _, err := r.revertWorkload(ctx, obj); err != nil {
+			revertErrors = append(revertErrors, fmt.Errorf("failed to revert %s: %w", objectKey(obj), err))
+			continue
+		}
+		removeAffectedWorkload(&mdConf.Status, kindName(obj), obj.GetNamespace(), obj.GetName())
+
+		now := metav1.Now()
+		setFailedWorkload(&mdConf.Status, apiv1alpha1.FailedWorkload{
+			WorkloadReference: workloadReference(obj),
+			Reason:            reason,
+			Message:           message,
+			FailureTime:       now,
+		})
+		mdConf.Status.LastRevertTime = &now
+		setCondition(mdConf, apiv1alpha1.ConditionReverted, metav1.ConditionTrue, "RolloutFailed",
+			fmt.Sprintf("Restored the original pod template of %s after its rollout failed", objectKey(obj)))
+	}
+	return inProgress, kerrors.NewAggregate(revertErrors)
+}
+
+// rolloutFailure returns why the rollout of the workload after the injection failed. An empty
+// reason means the rollout did not fail.
+func (r *ConfigurationReconciler) rolloutFailure(ctx context.Context, obj client.Object, injectionTime time.Time, maxRestarts int32) (string, string, error) {
+	if cm, ok := obj.(*kapps.Deployment); ok {
+		progressing := deploymentCondition(&cm.Status, kapps.DeploymentProgressing)
+		if progressing != nil && progressing.Reason == "ProgressDeadlineExceeded" && !progressing.LastUpdateTime.Time.Before(injectionTime) {
+			return "ProgressDeadlineExceeded", progressing.Message, nil
+		}
+	}
+
+	labelSelector := kindOf(obj).selector(obj)
+	if labelSelector == nil {
+		return "", "", nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return "", "", err
+	}
+	podList := &kcore.PodList{}
+	// Pods are read from the API server, so the manager does not cache every pod in the cluster
+	if err := r.APIReader.List(ctx, podList, client.InNamespace(obj.GetNamespace()), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return "", "", err
+	}
+
+	for _, pod := range podList.Items {
+		// Only the pods created from the misconfigured template count
+		if pod.CreationTimestamp.Time.Before(injectionTime) {
+			continue
+		}
+		statuses := append([]kcore.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if reason, message := containerFailure(pod.Name, status, maxRestarts); reason != "" {
+				return reason, message, nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// containerFailure returns why a container of a pod failed. Containers fail when they restarted
+// too often or wait for a reason that does not resolve without a change of the pod template.
+func containerFailure(podName string, status kcore.ContainerStatus, maxRestarts int32) (string, string) {
+	waiting := status.State.Waiting
+	if status.RestartCount >= maxRestarts {
+		message := fmt.Sprintf("Container %s of pod %s restarted %d times", status.Name, podName, status.RestartCount)
+		if waiting != nil && waiting.Reason != "" {
+			message = fmt.Sprintf("%s: %s", message, waiting.Reason)
+		}
+		return "CrashLoop", message
+	}
+	if waiting != nil && failedWaitingReasons[waiting.Reason] {
+		message := fmt.Sprintf("Container %s of pod %s is waiting: %s", status.Name, podName, waiting.Reason)
+		if waiting.Message != "" {
+			message = fmt.Sprintf("%s: %s", message, waiting.Message)
+		}
+		return waiting.Reason, message
+	}
+	return "", ""
+}
+
+// setFailedWorkload adds the workload to the failed workloads or replaces its previous entry
+func setFailedWorkload(status *apiv1alpha1.ConfigurationStatus, workload apiv1alpha1.FailedWorkload) {
+	removeFailedWorkload(status, workload.Kind, workload.Namespace, workload.Name)
+	status.FailedWorkloads = append(status.FailedWorkloads, workload)
+}
+
+// removeFailedWorkload removes a workload from the failed workloads
+func removeFailedWorkload(status *apiv1alpha1.ConfigurationStatus, kind, namespace, name string) {
+	var workloads []apiv1alpha1.FailedWorkload
+	for _, workload := range status.FailedWorkloads {
+		if workload.Kind != kind || workload.Namespace != namespace || workload.Name != name {
+			workloads = append(workloads, workload)
+		}
+	}
+	status.FailedWorkloads = workloads
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"testing"
+
+	kcore "k8s.io/api/core/v1"
+)
+
+func TestContainerFailure(t *testing.T) {
+	waiting := func(reason string) kcore.ContainerState {
+		return kcore.ContainerState{Waiting: &kcore.ContainerStateWaiting{Reason: reason}}
+	}
+
+	tests := []struct {
+		name       string
+		status     kcore.ContainerStatus
+		wantReason string
+	}{
+		{"running", kcore.ContainerStatus{Name: "app", State: kcore.ContainerState{Running: &kcore.ContainerStateRunning{}}}, ""},
+		{"restarted below the limit", kcore.ContainerStatus{Name: "app", RestartCount: 2, State: waiting("CrashLoopBackOff")}, ""},
+		{"restarted at the limit", kcore.ContainerStatus{Name: "app", RestartCount: 3, State: waiting("CrashLoopBackOff")}, "CrashLoop"},
+		{"image pull error", kcore.ContainerStatus{Name: "app", State: waiting("ErrImagePull")}, "ErrImagePull"},
+		{"image pull back-off", kcore.ContainerStatus{Name: "app", State: waiting("ImagePullBackOff")}, "ImagePullBackOff"},
+		{"invalid container config", kcore.ContainerStatus{Name: "app", State: waiting("CreateContainerConfigError")}, "CreateContainerConfigError"},
+		{"creating", kcore.ContainerStatus{Name: "app", State: waiting("ContainerCreating")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, message := containerFailure("app-0", tt.status, 3)
+			if reason != tt.wantReason {
+				t.Errorf("containerFailure() reason = %q, want %q", reason, tt.wantReason)
+			}
+			if (message != "") != (tt.wantReason != "") {
+				t.Errorf("containerFailure() message = %q for reason %q", message, reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+// maxMissedRuns is the number of missed runs above which they are no longer counted
+const maxMissedRuns = 100
+
+// parseSchedule parses the cron schedule of the Configuration in its time zone
+func parseSchedule(spec *apiv1alpha1.ConfigurationSpec) (cron.Schedule, error) {
+	schedule := spec.Schedule
+	if spec.TimeZone != nil {
+		if _, err := time.LoadLocation(*spec.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", *spec.TimeZone, err)
+		}
+		schedule = "CRON_TZ=" + *spec.TimeZone + " " + schedule
+	}
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec.Schedule, err)
+	}
+	return sched, nil
+}
+
+// scheduledRun returns the scheduled time of the run that is due now, if any, and the time of the next run.
+// Only the most recent of several missed runs is started and runs missed for longer than the starting deadline are skipped.
+func scheduledRun(ctx context.Context, mdConf *apiv1alpha1.Configuration, now time.Time) (*time.Time, time.Time, error) {
+	sched, err := parseSchedule(&mdConf.Spec)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	earliest := mdConf.CreationTimestamp.Time
+	if mdConf.Status.LastRunTime != nil {
+		earliest = mdConf.Status.LastRunTime.Time
+	}
+	// runs missed for longer than the starting deadline are skipped
+	if deadline := mdConf.Spec.StartingDeadlineSeconds; deadline != nil {
+		if start := now.Add(-time.Duration(*deadline) * time.Second); start.After(earliest) {
+			earliest = start
+		}
+	}
+
+	due := latestRun(sched, earliest, now)
+	next := sched.Next(now)
+	if due == nil {
+		return nil, next, nil
+	}
+
+	// like the CronJob controller, missed runs are only counted up to a limit
+	missed := -1
+	for t := sched.Next(earliest); !t.After(*due) && missed < maxMissedRuns; t = sched.Next(t) {
+		missed++
+	}
+	if missed >= maxMissedRuns {
+		log.FromContext(ctx).Info("Too many missed scheduled runs, starting the most recent one", "scheduledTime", due)
+	} else if missed > 0 {
+		log.FromContext(ctx).Info("Missed scheduled runs, starting the most recent one", "missed", missed, "scheduledTime", due)
+	}
+	return due, next, nil
+}
+
+// latestRun returns the latest scheduled time after earliest and not after now, if any. The window
+// before now is doubled until it holds a scheduled time, so long outages are not walked run by run.
+func latestRun(sched cron.Schedule, earliest, now time.Time) *time.Time {
+	for window := time.Minute; ; window *= 2 {
+		start := now.Add(-window)
+		if !start.After(earliest) {
+			start = earliest
+		}
+		if t := sched.Next(start); !t.After(now) {
+			for next := sched.Next(t); !next.After(now); next = sched.Next(next) {
+				t = next
+			}
+			return &t
+		}
+		if start.Equal(earliest) {
+			return nil
+		}
+	}
+}
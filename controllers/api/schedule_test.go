@@ -0,0 +1,152 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+func TestScheduledRun(t *testing.T) {
+	created := time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC)
+	berlin := "Europe/Berlin"
+	invalidZone := "Mars/Olympus"
+	deadline := int64(600)
+
+	tests := []struct {
+		name     string
+		spec     apiv1alpha1.ConfigurationSpec
+		lastRun  *time.Time
+		now      time.Time
+		wantDue  *time.Time
+		wantNext time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "no run due before the first scheduled time",
+			spec:     apiv1alpha1.ConfigurationSpec{Schedule: "0 9 * * *"},
+			now:      time.Date(2023, 5, 1, 8, 30, 0, 0, time.UTC),
+			wantNext: time.Date(2023, 5, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "run due at the scheduled time",
+			spec:     apiv1alpha1.ConfigurationSpec{Schedule: "0 9 * * *"},
+			now:      time.Date(2023, 5, 1, 9, 0, 30, 0, time.UTC),
+			wantDue:  timePtr(time.Date(2023, 5, 1, 9, 0, 0, 0, time.UTC)),
+			wantNext: time.Date(2023, 5, 2, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "run already started is not due again",
+			spec:     apiv1alpha1.ConfigurationSpec{Schedule: "0 9 * * *"},
+			lastRun:  timePtr(time.Date(2023, 5, 1, 9, 0, 0, 0, time.UTC)),
+			now:      time.Date(2023, 5, 1, 9, 5, 0, 0, time.UTC),
+			wantNext: time.Date(2023, 5, 2, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "only the most recent missed run is started",
+			spec:     apiv1alpha1.ConfigurationSpec{Schedule: "0 9 * * *"},
+			lastRun:  timePtr(time.Date(2023, 5, 1, 9, 0, 0, 0, time.UTC)),
+			now:      time.Date(2023, 5, 4, 12, 0, 0, 0, time.UTC),
+			wantDue:  timePtr(time.Date(2023, 5, 4, 9, 0, 0, 0, time.UTC)),
+			wantNext: time.Date(2023, 5, 5, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "most recent of more missed runs than are counted is started",
+			spec:     apiv1alpha1.ConfigurationSpec{Schedule: "* * * * *"},
+			lastRun:  timePtr(time.Date(2023, 5, 1, 9, 0, 0, 0, time.UTC)),
+			now:      time.Date(2023, 5, 8, 12, 30, 15, 0, time.UTC),
+			wantDue:  timePtr(time.Date(2023, 5, 8, 12, 30, 0, 0, time.UTC)),
+			wantNext: time.Date(2023, 5, 8, 12, 31, 0, 0, time.UTC),
+		},
+		{
+			name:     "most recent missed run of a sparse schedule is started",
+			spec:     apiv1alpha1.ConfigurationSpec{Schedule: "*/5 9 * * 1"},
+			lastRun:  timePtr(time.Date(2023, 5, 1, 9, 0, 0, 0, time.UTC)),
+			now:      time.Date(2023, 5, 8, 14, 0, 0, 0, time.UTC),
+			wantDue:  timePtr(time.Date(2023, 5, 8, 9, 55, 0, 0, time.UTC)),
+			wantNext: time.Date(2023, 5, 15, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "missed run past the starting deadline is skipped",
+			spec:     apiv1alpha1.ConfigurationSpec{Schedule: "0 9 * * *", StartingDeadlineSeconds: &deadline},
+			lastRun:  timePtr(time.Date(2023, 5, 1, 9, 0, 0, 0, time.UTC)),
+			now:      time.Date(2023, 5, 4, 12, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2023, 5, 5, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "missed run within the starting deadline is started",
+			spec:     apiv1alpha1.ConfigurationSpec{Schedule: "0 9 * * *", StartingDeadlineSeconds: &deadline},
+			lastRun:  timePtr(time.Date(2023, 5, 1, 9, 0, 0, 0, time.UTC)),
+			now:      time.Date(2023, 5, 4, 9, 5, 0, 0, time.UTC),
+			wantDue:  timePtr(time.Date(2023, 5, 4, 9, 0, 0, 0, time.UTC)),
+			wantNext: time.Date(2023, 5, 5, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "schedule is interpreted in the time zone",
+			spec:     apiv1alpha1.ConfigurationSpec{Schedule: "0 9 * * *", TimeZone: &berlin},
+			now:      time.Date(2023, 5, 2, 7, 30, 0, 0, time.UTC),
+			wantDue:  timePtr(time.Date(2023, 5, 2, 7, 0, 0, 0, time.UTC)),
+			wantNext: time.Date(2023, 5, 3, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "invalid time zone",
+			spec:    apiv1alpha1.ConfigurationSpec{Schedule: "0 9 * * *", TimeZone: &invalidZone},
+			now:     created,
+			wantErr: true,
+		},
+		{
+			name:    "invalid schedule",
+			spec:    apiv1alpha1.ConfigurationSpec{Schedule: "every day"},
+			now:     created,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mdConf := &apiv1alpha1.Configuration{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+				Spec:       tt.spec,
+			}
+			if tt.lastRun != nil {
+				mdConf.Status.LastRunTime = &metav1.Time{Time: *tt.lastRun}
+			}
+
+			due, next, err := scheduledRun(context.Background(), mdConf, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scheduledRun() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (due == nil) != (tt.wantDue == nil) || (due != nil && !due.Equal(*tt.wantDue)) {
+				t.Errorf("scheduledRun() due = %v, want %v", due, tt.wantDue)
+			}
+			if !next.Equal(tt.wantNext) {
+				t.Errorf("scheduledRun() next = %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
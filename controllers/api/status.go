@@ -0,0 +1,163 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+// updateStatus sets the conditions of the Configuration from the outcome of the reconciliation
+// and writes the status. The reconcile error is returned unless writing the status failed.
+func (r *ConfigurationReconciler) updateStatus(ctx context.Context, mdConf *apiv1alpha1.Configuration, reconcileErr error) error {
+	status := &mdConf.Status
+	status.ObservedGeneration = mdConf.Generation
+
+	if len(status.AffectedWorkloads) > 0 {
+		setCondition(mdConf, apiv1alpha1.ConditionInjected, metav1.ConditionTrue, "Injected",
+			fmt.Sprintf("Misconfiguration injected into %d workload(s)", len(status.AffectedWorkloads)))
+	} else if mdConf.Spec.Suspend {
+		setCondition(mdConf, apiv1alpha1.ConditionInjected, metav1.ConditionFalse, "Suspended",
+			"Misconfiguration is not injected while the Configuration is suspended")
+	} else if mdConf.Spec.DryRun {
+		setCondition(mdConf, apiv1alpha1.ConditionInjected, metav1.ConditionFalse, "DryRun",
+			"Misconfiguration is not injected in dry run mode")
+	} else {
+		setCondition(mdConf, apiv1alpha1.ConditionInjected, metav1.ConditionFalse, "NoTargets",
+			"Misconfiguration is not injected into any workload")
+	}
+
+	if mdConf.Spec.Suspend {
+		setCondition(mdConf, apiv1alpha1.ConditionSuspended, metav1.ConditionTrue, "Suspended",
+			"No workloads are misconfigured while the Configuration is suspended")
+	} else {
+		setCondition(mdConf, apiv1alpha1.ConditionSuspended, metav1.ConditionFalse, "Active", "")
+	}
+
+	if len(status.FailedWorkloads) > 0 {
+		failed := status.FailedWorkloads[len(status.FailedWorkloads)-1]
+		setCondition(mdConf, apiv1alpha1.ConditionFailed, metav1.ConditionTrue, failed.Reason,
+			fmt.Sprintf("Rollout of %s failed and was reverted: %s", workloadKey(failed.Namespace, failed.Name), failed.Message))
+	} else {
+		setCondition(mdConf, apiv1alpha1.ConditionFailed, metav1.ConditionFalse, "NoFailedRollouts", "")
+	}
+
+	if reconcileErr != nil {
+		setCondition(mdConf, apiv1alpha1.ConditionDegraded, metav1.ConditionTrue, "UpdateFailed", reconcileErr.Error())
+		setCondition(mdConf, apiv1alpha1.ConditionReady, metav1.ConditionFalse, "ReconcileFailed", reconcileErr.Error())
+	} else {
+		setCondition(mdConf, apiv1alpha1.ConditionDegraded, metav1.ConditionFalse, "AllTargetsUpdated", "")
+		setCondition(mdConf, apiv1alpha1.ConditionReady, metav1.ConditionTrue, "ReconcileSucceeded", "")
+	}
+
+	if err := r.Status().Update(ctx, mdConf); err != nil {
+		return err
+	}
+	return reconcileErr
+}
+
+func setCondition(mdConf *apiv1alpha1.Configuration, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&mdConf.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: mdConf.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setConflictCondition reports the workloads that are claimed by more than one Configuration
+func setConflictCondition(mdConf *apiv1alpha1.Configuration, skipped []apiv1alpha1.SkippedWorkload) {
+	var conflicts []string
+	for _, workload := range skipped {
+		if workload.Reason == "Conflict" {
+			conflicts = append(conflicts, workloadKey(workload.Namespace, workload.Name))
+		}
+	}
+	if len(conflicts) > 0 {
+		setCondition(mdConf, apiv1alpha1.ConditionConflicted, metav1.ConditionTrue, "MultipleConfigurations",
+			fmt.Sprintf("Workloads claimed by more than one Configuration: %s", strings.Join(conflicts, ", ")))
+	} else {
+		setCondition(mdConf, apiv1alpha1.ConditionConflicted, metav1.ConditionFalse, "NoConflicts", "")
+	}
+}
+
+// setAffectedWorkload adds the workload to the affected workloads or replaces its previous entry
+func setAffectedWorkload(status *apiv1alpha1.ConfigurationStatus, workload apiv1alpha1.AffectedWorkload) {
+	for i := range status.AffectedWorkloads {
+		existing := &status.AffectedWorkloads[i]
+		if existing.Kind == workload.Kind && existing.Namespace == workload.Namespace && existing.Name == workload.Name {
+			*existing = workload
+			return
+		}
+	}
+	status.AffectedWorkloads = append(status.AffectedWorkloads, workload)
+}
+
+// removeAffectedWorkload removes a workload from the affected workloads
+func removeAffectedWorkload(status *apiv1alpha1.ConfigurationStatus, kind, namespace, name string) {
+	var workloads []apiv1alpha1.AffectedWorkload
+	for _, workload := range status.AffectedWorkloads {
+		if workload.Kind != kind || workload.Namespace != namespace || workload.Name != name {
+			workloads = append(workloads, workload)
+		}
+	}
+	status.AffectedWorkloads = workloads
+}
+
+// pruneAffectedWorkloads removes the affected workloads that are not part of the experiment anymore
+func pruneAffectedWorkloads(status *apiv1alpha1.ConfigurationStatus, current map[string]bool) {
+	var workloads []apiv1alpha1.AffectedWorkload
+	for _, workload := range status.AffectedWorkloads {
+		if current[workload.Kind+"/"+workloadKey(workload.Namespace, workload.Name)] {
+			workloads = append(workloads, workload)
+		}
+	}
+	status.AffectedWorkloads = workloads
+}
+
+func workloadReference(obj client.Object) apiv1alpha1.WorkloadReference {
+	return apiv1alpha1.WorkloadReference{
+		Kind:      kindName(obj),
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}
+}
+
+func skippedWorkload(obj client.Object, reason, message string) apiv1alpha1.SkippedWorkload {
+	return apiv1alpha1.SkippedWorkload{
+		WorkloadReference: workloadReference(obj),
+		Reason:            reason,
+		Message:           message,
+	}
+}
+
+func workloadKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// objectKey identifies a workload of any kind
+func objectKey(obj client.Object) string {
+	return kindName(obj) + "/" + workloadKey(obj.GetNamespace(), obj.GetName())
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	kcore "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+// listWorkloads returns the workloads of every kind selected by the namespace and label selectors of the Configuration
+func (r *ConfigurationReconciler) listWorkloads(ctx context.Context, mdConf *apiv1alpha1.Configuration) ([]client.Object, error) {
+	var opts []client.ListOption
+	if mdConf.Spec.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(mdConf.Spec.Selector)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.MatchingLabelsSelector{Selector: selector})
+	}
+
+	if mdConf.Spec.NamespaceSelector == nil {
+		return r.listWorkloadsWith(ctx, mdConf, opts...)
+	}
+
+	namespaceSelector, err := metav1.LabelSelectorAsSelector(mdConf.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	namespaceList := &kcore.NamespaceList{}
+	if err := r.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: namespaceSelector}); err != nil {
+		return nil, err
+	}
+
+	var workloads []client.Object
+	for _, namespace := range namespaceList.Items {
+		namespaced, err := r.listWorkloadsWith(ctx, mdConf, append(opts, client.InNamespace(namespace.Name))...)
+		if err != nil {
+			return nil, err
+		}
+		workloads = append(workloads, namespaced...)
+	}
+	return workloads, nil
+}
+
+// listWorkloadsWith returns the workloads of every kind or the resources patched by the Configuration
+// matching the list options
+func (r *ConfigurationReconciler) listWorkloadsWith(ctx context.Context, mdConf *apiv1alpha1.Configuration, opts ...client.ListOption) ([]client.Object, error) {
+	if mdConf.Spec.Patch != nil {
+		return r.listPatchTargets(ctx, mdConf.Spec.Patch, opts...)
+	}
+	return r.listPodTemplateWorkloads(ctx, opts...)
+}
+
+// listPodTemplateWorkloads returns the workloads of every kind matching the list options
+func (r *ConfigurationReconciler) listPodTemplateWorkloads(ctx context.Context, opts ...client.ListOption) ([]client.Object, error) {
+	var workloads []client.Object
+	for _, kind := range workloadKinds {
+		list := kind.newList()
+		if err := r.List(ctx, list, opts...); err != nil {
+			return nil, err
+		}
+		items, err := listItems(list)
+		if err != nil {
+			return nil, err
+		}
+		workloads = append(workloads, items...)
+	}
+	return workloads, nil
+}
+
+// limitTargets limits the targets to the maximum count and percentage of workloads of the Configuration
+// and returns the selected and the skipped targets. The percentage is relative to the number of
+// workloads selected by the Configuration. Workloads that are already injected count against both limits.
+func limitTargets(spec *apiv1alpha1.ConfigurationSpec, targets []client.Object, selected, injected int) ([]client.Object, []client.Object) {
+	sortTargets(targets)
+
+	limit := len(targets)
+	if spec.MaxTargets != nil && int(*spec.MaxTargets)-injected < limit {
+		limit = int(*spec.MaxTargets) - injected
+	}
+	if spec.MaxPercent != nil {
+		if maxPercent := selected*int(*spec.MaxPercent)/100 - injected; maxPercent < limit {
+			limit = maxPercent
+		}
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	return targets[:limit], targets[limit:]
+}
+
+// sampleTargets picks a random subset of the targets with the given seed and returns the picked and
+// the remaining targets. The same seed picks the same targets from the same set of workloads.
+func sampleTargets(sampling *apiv1alpha1.Sampling, targets []client.Object, seed int64) ([]client.Object, []client.Object, error) {
+	sortTargets(targets)
+	random := rand.New(rand.NewSource(seed))
+
+	var picked, remaining []client.Object
+	switch sampling.Mode {
+	case apiv1alpha1.SamplingProbability:
+		probability, err := strconv.ParseFloat(sampling.Probability, 64)
+		if err != nil || probability < 0 || probability > 1 {
+			return nil, nil, fmt.Errorf("invalid sampling probability %q", sampling.Probability)
+		}
+		for _, target := range targets {
+			if random.Float64() < probability {
+				picked = append(picked, target)
+			} else {
+				remaining = append(remaining, target)
+			}
+		}
+	case apiv1alpha1.SamplingCount:
+		count := len(targets)
+		if sampling.Count != nil && int(*sampling.Count) < count {
+			count = int(*sampling.Count)
+		}
+		for i, j := range random.Perm(len(targets)) {
+			if i < count {
+				picked = append(picked, targets[j])
+			} else {
+				remaining = append(remaining, targets[j])
+			}
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown sampling mode %q", sampling.Mode)
+	}
+	return picked, remaining, nil
+}
+
+// sortTargets sorts the targets by kind, namespace and name
+func sortTargets(targets []client.Object) {
+	sort.Slice(targets, func(i, j int) bool {
+		return objectKey(targets[i]) < objectKey(targets[j])
+	})
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	kapps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+// deployments returns n Deployments named app-0 to app-<n-1> in reverse order
+func deployments(n int) []client.Object {
+	var objects []client.Object
+	for i := n - 1; i >= 0; i-- {
+		objects = append(objects, &kapps.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: fmt.Sprintf("app-%d", i)}})
+	}
+	return objects
+}
+
+func names(objects []client.Object) []string {
+	var names []string
+	for _, obj := range objects {
+		names = append(names, obj.GetName())
+	}
+	return names
+}
+
+func TestLimitTargets(t *testing.T) {
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	tests := []struct {
+		name         string
+		spec         apiv1alpha1.ConfigurationSpec
+		targets      int
+		selected     int
+		injected     int
+		wantSelected []string
+		wantSkipped  []string
+	}{
+		{
+			name:         "no limits",
+			targets:      3,
+			selected:     3,
+			wantSelected: []string{"app-0", "app-1", "app-2"},
+		},
+		{
+			name:         "maxTargets",
+			spec:         apiv1alpha1.ConfigurationSpec{MaxTargets: int32Ptr(2)},
+			targets:      3,
+			selected:     3,
+			wantSelected: []string{"app-0", "app-1"},
+			wantSkipped:  []string{"app-2"},
+		},
+		{
+			name:         "maxPercent is rounded down",
+			spec:         apiv1alpha1.ConfigurationSpec{MaxPercent: int32Ptr(50)},
+			targets:      3,
+			selected:     3,
+			wantSelected: []string{"app-0"},
+			wantSkipped:  []string{"app-1", "app-2"},
+		},
+		{
+			name:         "maxPercent is relative to the selected workloads",
+			spec:         apiv1alpha1.ConfigurationSpec{MaxPercent: int32Ptr(50)},
+			targets:      3,
+			selected:     6,
+			wantSelected: []string{"app-0", "app-1", "app-2"},
+		},
+		{
+			name:         "the lower limit wins",
+			spec:         apiv1alpha1.ConfigurationSpec{MaxTargets: int32Ptr(1), MaxPercent: int32Ptr(100)},
+			targets:      3,
+			selected:     3,
+			wantSelected: []string{"app-0"},
+			wantSkipped:  []string{"app-1", "app-2"},
+		},
+		{
+			name:         "injected workloads count against maxTargets",
+			spec:         apiv1alpha1.ConfigurationSpec{MaxTargets: int32Ptr(2)},
+			targets:      3,
+			selected:     4,
+			injected:     1,
+			wantSelected: []string{"app-0"},
+			wantSkipped:  []string{"app-1", "app-2"},
+		},
+		{
+			name:        "no targets once maxTargets is injected",
+			spec:        apiv1alpha1.ConfigurationSpec{MaxTargets: int32Ptr(1)},
+			targets:     9,
+			selected:    10,
+			injected:    1,
+			wantSkipped: []string{"app-0", "app-1", "app-2", "app-3", "app-4", "app-5", "app-6", "app-7", "app-8"},
+		},
+		{
+			name:        "injected workloads count against maxPercent",
+			spec:        apiv1alpha1.ConfigurationSpec{MaxPercent: int32Ptr(25)},
+			targets:     2,
+			selected:    8,
+			injected:    3,
+			wantSkipped: []string{"app-0", "app-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, skipped := limitTargets(&tt.spec, deployments(tt.targets), tt.selected, tt.injected)
+			if got := names(selected); !reflect.DeepEqual(got, tt.wantSelected) {
+				t.Errorf("limitTargets() selected = %v, want %v", got, tt.wantSelected)
+			}
+			if got := names(skipped); !reflect.DeepEqual(got, tt.wantSkipped) {
+				t.Errorf("limitTargets() skipped = %v, want %v", got, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestSampleTargets(t *testing.T) {
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	tests := []struct {
+		name       string
+		sampling   apiv1alpha1.Sampling
+		targets    int
+		wantPicked int
+		wantErr    bool
+	}{
+		{"count", apiv1alpha1.Sampling{Mode: apiv1alpha1.SamplingCount, Count: int32Ptr(3)}, 10, 3, false},
+		{"count above the number of targets", apiv1alpha1.Sampling{Mode: apiv1alpha1.SamplingCount, Count: int32Ptr(20)}, 10, 10, false},
+		{"count without a count picks every target", apiv1alpha1.Sampling{Mode: apiv1alpha1.SamplingCount}, 10, 10, false},
+		{"probability 0", apiv1alpha1.Sampling{Mode: apiv1alpha1.SamplingProbability, Probability: "0"}, 10, 0, false},
+		{"probability 1", apiv1alpha1.Sampling{Mode: apiv1alpha1.SamplingProbability, Probability: "1"}, 10, 10, false},
+		{"invalid probability", apiv1alpha1.Sampling{Mode: apiv1alpha1.SamplingProbability, Probability: "1.5"}, 10, 0, true},
+		{"unknown mode", apiv1alpha1.Sampling{Mode: "Sometimes"}, 10, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picked, remaining, err := sampleTargets(&tt.sampling, deployments(tt.targets), 42)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sampleTargets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(picked) != tt.wantPicked || len(picked)+len(remaining) != tt.targets {
+				t.Errorf("sampleTargets() picked %d and left %d, want %d of %d", len(picked), len(remaining), tt.wantPicked, tt.targets)
+			}
+		})
+	}
+}
+
+func TestSampleTargetsSeed(t *testing.T) {
+	samplings := []apiv1alpha1.Sampling{
+		{Mode: apiv1alpha1.SamplingProbability, Probability: "0.5"},
+		{Mode: apiv1alpha1.SamplingCount, Count: func(i int32) *int32 { return &i }(4)},
+	}
+	for _, sampling := range samplings {
+		t.Run(string(sampling.Mode), func(t *testing.T) {
+			picked, _, err := sampleTargets(&sampling, deployments(20), 42)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The same seed picks the same targets, regardless of the order they were listed in
+			reversed := deployments(20)
+			for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+				reversed[i], reversed[j] = reversed[j], reversed[i]
+			}
+			replayed, _, err := sampleTargets(&sampling, reversed, 42)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names(picked), names(replayed)) {
+				t.Errorf("replay with the same seed picked %v, want %v", names(replayed), names(picked))
+			}
+
+			other, _, err := sampleTargets(&sampling, deployments(20), 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.DeepEqual(names(picked), names(other)) {
+				t.Errorf("different seeds picked the same targets %v", names(picked))
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+// annotatedWorkload filters the events of workloads that take part in an experiment
+var annotatedWorkload = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return isAnnotated(e.Object)
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return isAnnotated(e.ObjectOld) || isAnnotated(e.ObjectNew)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return isAnnotated(e.Object)
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return isAnnotated(e.Object)
+	},
+}
+
+// isAnnotated reports whether the workload opted in to the misconfiguration or is currently injected.
+// Workloads managed by another workload only inherit its annotations.
+func isAnnotated(obj client.Object) bool {
+	if metav1.GetControllerOf(obj) != nil {
+		return false
+	}
+	annotations := obj.GetAnnotations()
+	_, optedIn := annotations[annotationName]
+	_, injected := annotations[injectedByAnnotationName]
+	return optedIn || injected
+}
+
+// configurationsForWorkload maps a workload to the Configurations that select, claim or were injected into it
+func (r *ConfigurationReconciler) configurationsForWorkload(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+
+	configurationList := &apiv1alpha1.ConfigurationList{}
+	if err := r.List(ctx, configurationList); err != nil {
+		r.Log.Error(err, "Failed to list Configurations", "workload", obj.GetName(), "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	claimed, _ := claimedConfiguration(obj)
+	var requests []reconcile.Request
+	for i := range configurationList.Items {
+		mdConf := &configurationList.Items[i]
+		key := configurationKey(mdConf)
+		if key != claimed && key != obj.GetAnnotations()[injectedByAnnotationName] {
+			selected, err := r.selectsWorkload(ctx, mdConf, obj)
+			if err != nil {
+				r.Log.Error(err, "Failed to match the workload", "workload", obj.GetName(), "namespace", obj.GetNamespace())
+				return nil
+			}
+			if !selected {
+				continue
+			}
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mdConf)})
+	}
+	return requests
+}
+
+// configurationsForConfiguration maps a Configuration to the other Configurations, which may
+// have to resolve conflicts over their workloads when it changes
+func (r *ConfigurationReconciler) configurationsForConfiguration(obj client.Object) []reconcile.Request {
+	configurationList := &apiv1alpha1.ConfigurationList{}
+	if err := r.List(context.Background(), configurationList); err != nil {
+		r.Log.Error(err, "Failed to list Configurations")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range configurationList.Items {
+		mdConf := &configurationList.Items[i]
+		if mdConf.Namespace != obj.GetNamespace() || mdConf.Name != obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mdConf)})
+		}
+	}
+	return requests
+}
+
+// allConfigurations maps an object to every Configuration
+func (r *ConfigurationReconciler) allConfigurations(obj client.Object) []reconcile.Request {
+	configurationList := &apiv1alpha1.ConfigurationList{}
+	if err := r.List(context.Background(), configurationList); err != nil {
+		r.Log.Error(err, "Failed to list Configurations")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range configurationList.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&configurationList.Items[i])})
+	}
+	return requests
+}
+
+// selectorMatches reports whether the labels match the selector. An empty selector matches everything.
+func selectorMatches(selector *metav1.LabelSelector, objLabels map[string]string) bool {
+	if selector == nil {
+		return true
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false
+	}
+	return s.Matches(labels.Set(objLabels))
+}
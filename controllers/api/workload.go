@@ -0,0 +1,213 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	kapps "k8s.io/api/apps/v1"
+	kbatch "k8s.io/api/batch/v1"
+	kcore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
+)
+
+// workloadKind describes how the misconfiguration is applied to a kind of workload with a pod template
+type workloadKind struct {
+	gvk schema.GroupVersionKind
+
+	// templatePath is the path of the pod template in the spec of the workload
+	templatePath []string
+
+	// immutableTemplate is set for kinds whose pod template cannot be changed
+	immutableTemplate bool
+
+	newObject   func() client.Object
+	newList     func() client.ObjectList
+	podTemplate func(obj client.Object) *kcore.PodTemplateSpec
+	selector    func(obj client.Object) *metav1.LabelSelector
+	notReady    func(gate *apiv1alpha1.ReadinessGate, obj client.Object) (string, string)
+}
+
+// workloadKinds are the kinds of workloads the misconfiguration is applied to
+var workloadKinds = []*workloadKind{
+	{
+		gvk:          kapps.SchemeGroupVersion.WithKind("Deployment"),
+		templatePath: []string{"template"},
+		newObject:    func() client.Object { return &kapps.Deployment{} },
+		newList:      func() client.ObjectList { return &kapps.DeploymentList{} },
+		podTemplate:  func(obj client.Object) *kcore.PodTemplateSpec { return &obj.(*kapps.Deployment).Spec.Template },
+		selector:     func(obj client.Object) *metav1.LabelSelector { return obj.(*kapps.Deployment).Spec.Selector },
+		notReady: func(gate *apiv1alpha1.ReadinessGate, obj client.Object) (string, string) {
+			return deploymentNotReady(gate, obj.(*kapps.Deployment))
+		},
+	},
+	{
+		gvk:          kapps.SchemeGroupVersion.WithKind("StatefulSet"),
+		templatePath: []string{"template"},
+		newObject:    func() client.Object { return &kapps.StatefulSet{} },
+		newList:      func() client.ObjectList { return &kapps.StatefulSetList{} },
+		podTemplate:  func(obj client.Object) *kcore.PodTemplateSpec { return &obj.(*kapps.StatefulSet).Spec.Template },
+		selector:     func(obj client.Object) *metav1.LabelSelector { return obj.(*kapps.StatefulSet).Spec.Selector },
+		notReady: func(gate *apiv1alpha1.ReadinessGate, obj client.Object) (string, string) {
+			return statefulSetNotReady(gate, obj.(*kapps.StatefulSet))
+		},
+	},
+	{
+		gvk:          kapps.SchemeGroupVersion.WithKind("DaemonSet"),
+		templatePath: []string{"template"},
+		newObject:    func() client.Object { return &kapps.DaemonSet{} },
+		newList:      func() client.ObjectList { return &kapps.DaemonSetList{} },
+		podTemplate:  func(obj client.Object) *kcore.PodTemplateSpec { return &obj.(*kapps.DaemonSet).Spec.Template },
+		selector:     func(obj client.Object) *metav1.LabelSelector { return obj.(*kapps.DaemonSet).Spec.Selector },
+		notReady: func(gate *apiv1alpha1.ReadinessGate, obj client.Object) (string, string) {
+			return daemonSetNotReady(gate, obj.(*kapps.DaemonSet))
+		},
+	},
+	{
+		gvk:          kapps.SchemeGroupVersion.WithKind("ReplicaSet"),
+		templatePath: []string{"template"},
+		newObject:    func() client.Object { return &kapps.ReplicaSet{} },
+		newList:      func() client.ObjectList { return &kapps.ReplicaSetList{} },
+		podTemplate:  func(obj client.Object) *kcore.PodTemplateSpec { return &obj.(*kapps.ReplicaSet).Spec.Template },
+		selector:     func(obj client.Object) *metav1.LabelSelector { return obj.(*kapps.ReplicaSet).Spec.Selector },
+		notReady: func(gate *apiv1alpha1.ReadinessGate, obj client.Object) (string, string) {
+			return replicaSetNotReady(gate, obj.(*kapps.ReplicaSet))
+		},
+	},
+	{
+		gvk:               kbatch.SchemeGroupVersion.WithKind("Job"),
+		templatePath:      []string{"template"},
+		immutableTemplate: true,
+		newObject:         func() client.Object { return &kbatch.Job{} },
+		newList:           func() client.ObjectList { return &kbatch.JobList{} },
+		podTemplate:       func(obj client.Object) *kcore.PodTemplateSpec { return &obj.(*kbatch.Job).Spec.Template },
+		selector:          func(obj client.Object) *metav1.LabelSelector { return obj.(*kbatch.Job).Spec.Selector },
+		notReady: func(gate *apiv1alpha1.ReadinessGate, obj client.Object) (string, string) {
+			return "", ""
+		},
+	},
+	{
+		gvk:          kbatch.SchemeGroupVersion.WithKind("CronJob"),
+		templatePath: []string{"jobTemplate", "spec", "template"},
+		newObject:    func() client.Object { return &kbatch.CronJob{} },
+		newList:      func() client.ObjectList { return &kbatch.CronJobList{} },
+		podTemplate: func(obj client.Object) *kcore.PodTemplateSpec {
+			return &obj.(*kbatch.CronJob).Spec.JobTemplate.Spec.Template
+		},
+		// The pods of a CronJob belong to its Jobs and are not selected by the CronJob
+		selector: func(obj client.Object) *metav1.LabelSelector { return nil },
+		notReady: func(gate *apiv1alpha1.ReadinessGate, obj client.Object) (string, string) {
+			return "", ""
+		},
+	},
+}
+
+// kindOf returns the kind of the workload
+func kindOf(obj client.Object) *workloadKind {
+	var kind string
+	switch obj.(type) {
+	case *kapps.Deployment:
+		kind = "Deployment"
+	case *kapps.StatefulSet:
+		kind = "StatefulSet"
+	case *kapps.DaemonSet:
+		kind = "DaemonSet"
+	case *kapps.ReplicaSet:
+		kind = "ReplicaSet"
+	case *kbatch.Job:
+		kind = "Job"
+	case *kbatch.CronJob:
+		kind = "CronJob"
+	}
+	for _, k := range workloadKinds {
+		if k.gvk.Kind == kind {
+			return k
+		}
+	}
+	panic(fmt.Sprintf("unsupported workload %T", obj))
+}
+
+// kindName returns the kind of a workload or patched resource
+func kindName(obj client.Object) string {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.GetKind()
+	}
+	return kindOf(obj).gvk.Kind
+}
+
+// setAnnotation sets an annotation of the object. Unstructured objects return a copy of their annotations.
+func setAnnotation(obj client.Object, name, value string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[name] = value
+	obj.SetAnnotations(annotations)
+}
+
+// mergeAnnotations updates the annotations of a workload with a merge patch. Nil values remove an annotation.
+func (r *ConfigurationReconciler) mergeAnnotations(ctx context.Context, obj client.Object, annotations map[string]interface{}) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	return r.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data), client.FieldOwner(fieldManager))
+}
+
+// listItems returns the workloads of a list
+func listItems(list client.ObjectList) ([]client.Object, error) {
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]client.Object, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(client.Object)
+		if !ok {
+			return nil, fmt.Errorf("unexpected list item %T", item)
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// nestedTemplate returns the spec of the workload kind with the pod template at its path
+func (k *workloadKind) nestedTemplate(template map[string]interface{}) map[string]interface{} {
+	spec := map[string]interface{}{}
+	current := spec
+	for i, field := range k.templatePath {
+		if i == len(k.templatePath)-1 {
+			current[field] = template
+			break
+		}
+		next := map[string]interface{}{}
+		current[field] = next
+		current = next
+	}
+	return spec
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2023 AnaisUrlichs.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apps
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	kapps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/AnaisUrlichs/security-controller/controllers/killswitch"
+)
+
+const (
+	// rearmFieldManager owns the annotations that opt a workload in again
+	rearmFieldManager = "security-controller-rearm"
+	// rearmInterval is the time after the last update a reverted workload is opted in again
+	rearmInterval = 5 * time.Minute
+)
+
+// WorkloadReconciler reconciles a workload object with a pod template, e.g. a Deployment
+type WorkloadReconciler struct {
+	client.Client
+	Scheme     *runtime.Scheme
+	KillSwitch *killswitch.KillSwitch
+
+	// Object is the kind of workload reconciled
+	Object client.Object
+}
+
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments/finalizers,verbs=update
+// +kubebuilder:rbac:groups=apps,resources=statefulsets;daemonsets;replicasets,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;patch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.1/pkg/reconcile
+func (r *WorkloadReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	workload := r.Object.DeepCopyObject().(client.Object)
+
+	// Get the workload with annotation
+	if err := r.Get(ctx, req.NamespacedName, workload); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	// Workloads managed by another workload inherit its annotations
+	if metav1.GetControllerOf(workload) != nil {
+		return ctrl.Result{}, nil
+	}
+	gvk, err := apiutil.GVKForObject(workload, r.Scheme)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	l.Info(gvk.Kind, "name", workload.GetName(), "namespace", workload.GetNamespace(), "annotations", workload.GetAnnotations())
+
+	val, ok := workload.GetAnnotations()["anaisurl.com/misconfiguration"]
+
+	// Workloads that are still injected stay opted out until they are reverted, only reverted
+	// workloads are opted in again once the last update is older than the re-arm interval
+	_, injected := workload.GetAnnotations()["anaisurl.com/injected-by"]
+	if ok && val == "false" && !injected {
+
+		// Workloads are not opted in again while the kill switch is engaged
+		engaged, err := r.KillSwitch.Engaged(ctx)
+		if err != nil || engaged {
+			return ctrl.Result{}, err
+		}
+
+		lastUpdatedTime, err := time.Parse(time.RFC3339, workload.GetAnnotations()["anaisurl.com/last-updated"])
+		if err != nil {
+			lastUpdatedTime = workload.GetCreationTimestamp().Time
+		}
+		if remaining := rearmInterval - time.Since(lastUpdatedTime); remaining > 0 {
+			return ctrl.Result{RequeueAfter: remaining}, nil
+		}
+
+		val = "true"
+		// Apply the annotations to the workload
+		intent := &unstructured.Unstructured{}
+		intent.SetGroupVersionKind(gvk)
+		intent.SetNamespace(workload.GetNamespace())
+		intent.SetName(workload.GetName())
+		intent.SetAnnotations(map[string]string{
+			"anaisurl.com/misconfiguration": val,
+			"anaisurl.com/last-updated":     time.Now().Format(time.RFC3339),
+		})
+
+		if err := r.Patch(ctx, intent, client.Apply, client.FieldOwner(rearmFieldManager), client.ForceOwnership); err != nil {
+			return ctrl.Result{}, client.IgnoreNotFound(err)
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WorkloadReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Object == nil {
+		r.Object = &kapps.Deployment{}
+	}
+	gvk, err := apiutil.GVKForObject(r.Object, mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(strings.ToLower(gvk.Kind)).
+		For(r.Object).
+		Complete(r)
+}
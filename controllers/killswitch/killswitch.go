@@ -0,0 +1,78 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package killswitch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	kcore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// DefaultName is the name of the kill switch ConfigMap in the namespace of the controller
+	DefaultName = "security-controller-kill-switch"
+	// EngagedKey is the key of the kill switch ConfigMap that engages it when set to "true"
+	EngagedKey = "engaged"
+)
+
+// KillSwitch stops every experiment in the cluster while the "engaged" key of a well-known
+// ConfigMap is set to "true". No workload is misconfigured and every injection is reverted.
+type KillSwitch struct {
+	client.Reader
+	Key types.NamespacedName
+}
+
+// Engaged reports whether the kill switch is engaged. A missing ConfigMap leaves it released.
+func (k *KillSwitch) Engaged(ctx context.Context) (bool, error) {
+	if k == nil {
+		return false, nil
+	}
+	configMap := &kcore.ConfigMap{}
+	if err := k.Get(ctx, k.Key, configMap); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return configMap.Data[EngagedKey] == "true", nil
+}
+
+// Check fails the kill-switch readiness check of the manager while the kill switch is engaged. The
+// readiness probe of the manager excludes it, so the webhook keeps serving while it is engaged.
+func (k *KillSwitch) Check(req *http.Request) error {
+	engaged, err := k.Engaged(req.Context())
+	if err != nil {
+		return err
+	}
+	if engaged {
+		return fmt.Errorf("kill switch %s is engaged", k.Key)
+	}
+	return nil
+}
+
+// Predicate filters the events of the kill switch ConfigMap
+func (k *KillSwitch) Predicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return k != nil && obj.GetNamespace() == k.Key.Namespace && obj.GetName() == k.Key.Name
+	})
+}
@@ -18,22 +18,32 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	kapps "k8s.io/api/apps/v1"
+	kbatch "k8s.io/api/batch/v1"
+	kcore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	apiv1alpha1 "github.com/AnaisUrlichs/security-controller/apis/api/v1alpha1"
 	apicontrollers "github.com/AnaisUrlichs/security-controller/controllers/api"
 	appscontrollers "github.com/AnaisUrlichs/security-controller/controllers/apps"
+	"github.com/AnaisUrlichs/security-controller/controllers/killswitch"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -53,11 +63,21 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var killSwitchNamespace string
+	var killSwitchName string
+	var protectedNamespaces string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&killSwitchNamespace, "kill-switch-namespace", operatorNamespace(),
+		"The namespace of the kill switch ConfigMap. Defaults to the namespace of the controller manager.")
+	flag.StringVar(&killSwitchName, "kill-switch-name", killswitch.DefaultName,
+		"The name of the kill switch ConfigMap. Setting its \"engaged\" key to \"true\" stops and reverts every experiment.")
+	flag.StringVar(&protectedNamespaces, "protected-namespaces", "kube-system,kube-public,kube-node-lease",
+		"Comma separated list of namespaces no workload is misconfigured in. "+
+			"The namespace of the controller manager is always protected.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -73,6 +93,15 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "049a9d76.core.anaisurl.com",
+		// Only the kill switch ConfigMap is cached, other ConfigMaps are read from the API server
+		NewCache: cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&kcore.ConfigMap{}: {Field: fields.SelectorFromSet(fields.Set{
+					"metadata.namespace": killSwitchNamespace,
+					"metadata.name":      killSwitchName,
+				})},
+			},
+		}),
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -89,20 +118,45 @@ func main() {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
-	if err = (&appscontrollers.DeploymentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Deployment")
-		os.Exit(1)
+	killSwitch := &killswitch.KillSwitch{
+		Reader: mgr.GetClient(),
+		Key:    types.NamespacedName{Namespace: killSwitchNamespace, Name: killSwitchName},
+	}
+	for _, workload := range []client.Object{
+		&kapps.Deployment{},
+		&kapps.StatefulSet{},
+		&kapps.DaemonSet{},
+		&kapps.ReplicaSet{},
+		&kbatch.Job{},
+		&kbatch.CronJob{},
+	} {
+		if err = (&appscontrollers.WorkloadReconciler{
+			Client:     mgr.GetClient(),
+			Scheme:     mgr.GetScheme(),
+			KillSwitch: killSwitch,
+			Object:     workload,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", fmt.Sprintf("%T", workload))
+			os.Exit(1)
+		}
 	}
 	if err = (&apicontrollers.ConfigurationReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:              mgr.GetClient(),
+		APIReader:           mgr.GetAPIReader(),
+		Log:                 ctrl.Log.WithName("controllers").WithName("Configuration"),
+		Scheme:              mgr.GetScheme(),
+		KillSwitch:          killSwitch,
+		ProtectedNamespaces: append(splitList(protectedNamespaces), operatorNamespace()),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Configuration")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&apiv1alpha1.Configuration{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Configuration")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -113,6 +167,10 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("kill-switch", killSwitch.Check); err != nil {
+		setupLog.Error(err, "unable to set up kill switch check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -120,3 +178,22 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList returns the entries of a comma-separated list without surrounding spaces and empty entries
+func splitList(list string) []string {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// operatorNamespace returns the namespace the controller manager runs in
+func operatorNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	return "controller-system"
+}
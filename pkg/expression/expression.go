@@ -0,0 +1,95 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expression
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"k8s.io/utils/lru"
+)
+
+const (
+	// ObjectVariable is the variable the candidate object is bound to
+	ObjectVariable = "object"
+	// costLimit bounds the cost of evaluating an expression against a single object
+	costLimit = 1000000
+	// cacheSize bounds the number of compiled expressions that are kept
+	cacheSize = 256
+)
+
+var (
+	envOnce sync.Once
+	env     *cel.Env
+	envErr  error
+
+	// programs caches the most recently compiled expressions. The webhook compiles every submitted
+	// expression, so the cache is bounded.
+	programs = lru.New(cacheSize)
+)
+
+// newEnv returns the CEL environment target expressions are compiled in
+func newEnv() (*cel.Env, error) {
+	envOnce.Do(func() {
+		env, envErr = cel.NewEnv(
+			cel.Variable(ObjectVariable, cel.MapType(cel.StringType, cel.DynType)),
+			ext.Strings(),
+		)
+	})
+	return env, envErr
+}
+
+// Compile compiles a target expression. The expression is evaluated against the candidate
+// object bound to "object" and must return a bool.
+func Compile(expression string) (cel.Program, error) {
+	if program, ok := programs.Get(expression); ok {
+		return program.(cel.Program), nil
+	}
+
+	env, err := newEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if outputType := ast.OutputType(); outputType != cel.BoolType && outputType != cel.DynType {
+		return nil, fmt.Errorf("expression must return a bool, not %s", outputType)
+	}
+	program, err := env.Program(ast, cel.CostLimit(costLimit))
+	if err != nil {
+		return nil, err
+	}
+	programs.Add(expression, program)
+	return program, nil
+}
+
+// Matches evaluates the program against the object
+func Matches(program cel.Program, object map[string]interface{}) (bool, error) {
+	result, _, err := program.Eval(map[string]interface{}{ObjectVariable: object})
+	if err != nil {
+		return false, err
+	}
+	matched, ok := result.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %v instead of a bool", result.Value())
+	}
+	return matched, nil
+}
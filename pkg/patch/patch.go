@@ -0,0 +1,80 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package patch parses the patch documents of Configurations, so they can be validated on admission
+// and applied by the controller alike
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gomodules.xyz/jsonpatch/v2"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultType is the patch type of Configurations without a type
+const DefaultType = "MergePatch"
+
+// Types maps the patch types of a Configuration to the patch types of the API server
+var Types = map[string]types.PatchType{
+	"JSONPatch":           types.JSONPatchType,
+	"MergePatch":          types.MergePatchType,
+	"StrategicMergePatch": types.StrategicMergePatchType,
+}
+
+// Parse returns the patch type of the API server and the patch document as JSON. Patches of the
+// metadata or status are rejected, as they are not restored on revert.
+func Parse(patchType, document string) (types.PatchType, []byte, error) {
+	if patchType == "" {
+		patchType = DefaultType
+	}
+	serverType, ok := Types[patchType]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown patch type %q", patchType)
+	}
+	data, err := yaml.YAMLToJSON([]byte(document))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	var fields []string
+	if serverType == types.JSONPatchType {
+		var operations []jsonpatch.Operation
+		if err := json.Unmarshal(data, &operations); err != nil {
+			return "", nil, fmt.Errorf("invalid JSON patch: %w", err)
+		}
+		for _, operation := range operations {
+			fields = append(fields, strings.SplitN(strings.TrimPrefix(operation.Path, "/"), "/", 2)[0])
+		}
+	} else {
+		var patch map[string]interface{}
+		if err := json.Unmarshal(data, &patch); err != nil {
+			return "", nil, fmt.Errorf("invalid merge patch: %w", err)
+		}
+		for field := range patch {
+			fields = append(fields, field)
+		}
+	}
+	for _, field := range fields {
+		if field == "metadata" || field == "status" {
+			return "", nil, fmt.Errorf("patching the %s of a resource is not supported", field)
+		}
+	}
+	return serverType, data, nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2023 AnaisUrlichs.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patch
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		patchType string
+		document  string
+		wantType  types.PatchType
+		wantData  string
+		wantErr   bool
+	}{
+		{"merge patch by default", "", "spec:\n  host: evil.example.com\n", types.MergePatchType, `{"spec":{"host":"evil.example.com"}}`, false},
+		{"strategic merge patch", "StrategicMergePatch", `{"spec":{"tls":null}}`, types.StrategicMergePatchType, `{"spec":{"tls":null}}`, false},
+		{"JSON patch", "JSONPatch", `[{"op":"remove","path":"/spec/tls"}]`, types.JSONPatchType, `[{"op":"remove","path":"/spec/tls"}]`, false},
+		{"unknown type", "ApplyPatch", `{"spec":{}}`, "", "", true},
+		{"invalid YAML", "MergePatch", "spec: [", "", "", true},
+		{"JSON patch that is not a list", "JSONPatch", `{"spec":{}}`, "", "", true},
+		{"merge patch that is not an object", "MergePatch", `["spec"]`, "", "", true},
+		{"metadata", "MergePatch", `{"metadata":{"labels":{"a":"b"}}}`, "", "", true},
+		{"status by JSON patch", "JSONPatch", `[{"op":"remove","path":"/status/conditions"}]`, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patchType, data, err := Parse(tt.patchType, tt.document)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if patchType != tt.wantType || string(data) != tt.wantData {
+				t.Errorf("Parse() = %s %s, want %s %s", patchType, data, tt.wantType, tt.wantData)
+			}
+		})
+	}
+}